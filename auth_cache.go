@@ -0,0 +1,251 @@
+// Package ocpp: Local Authorization List and Authorization Cache.
+//
+// Adds SendLocalList/GetLocalListVersion and an AuthorizationStore so a
+// charge point built on this library can keep authorizing known idTags
+// while the central system is unreachable.
+
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// UpdateType represents whether a SendLocalList update replaces the whole
+// list or applies a differential change.
+type UpdateType string
+
+const (
+	UpdateTypeFull         UpdateType = "Full"
+	UpdateTypeDifferential UpdateType = "Differential"
+)
+
+// AuthListEntry represents a single entry in the local authorization list.
+type AuthListEntry struct {
+	IdTag     string    `json:"idTag" validate:"required,max=20"`
+	IdTagInfo IdTagInfo `json:"idTagInfo"`
+}
+
+// SendLocalListRequest represents a SendLocalList request.
+type SendLocalListRequest struct {
+	ListVersion            int             `json:"listVersion"`
+	LocalAuthorizationList []AuthListEntry `json:"localAuthorizationList,omitempty"`
+	UpdateType             UpdateType      `json:"updateType"`
+}
+
+// UpdateStatus represents the response status for SendLocalList.
+type UpdateStatus string
+
+const (
+	UpdateStatusAccepted     UpdateStatus = "Accepted"
+	UpdateStatusFailed       UpdateStatus = "Failed"
+	UpdateStatusNotSupported UpdateStatus = "NotSupported"
+	UpdateStatusVersionMismatch UpdateStatus = "VersionMismatch"
+)
+
+// SendLocalListResponse represents a SendLocalList response.
+type SendLocalListResponse struct {
+	Status UpdateStatus `json:"status"`
+}
+
+// GetLocalListVersionRequest represents a GetLocalListVersion request.
+type GetLocalListVersionRequest struct{}
+
+// GetLocalListVersionResponse represents a GetLocalListVersion response.
+type GetLocalListVersionResponse struct {
+	ListVersion int `json:"listVersion"`
+}
+
+// AuthorizationStore persists the local authorization list and serves as
+// the offline authorization cache. Implementations must be safe for
+// concurrent use.
+type AuthorizationStore interface {
+	// Get returns the cached IdTagInfo for idTag, if present.
+	Get(idTag string) (IdTagInfo, bool)
+	// Put caches IdTagInfo for idTag, e.g. after a successful remote Authorize.
+	Put(idTag string, info IdTagInfo)
+	// Version returns the local authorization list's current version.
+	Version() int
+	// ReplaceAll installs a full local authorization list at version.
+	ReplaceAll(version int, entries []AuthListEntry) error
+	// Update applies a differential local authorization list at version.
+	// version must be exactly the current version + 1.
+	Update(version int, entries []AuthListEntry) error
+}
+
+// MemoryAuthStore is an in-memory AuthorizationStore. It is the default
+// store used by Client when none is configured.
+type MemoryAuthStore struct {
+	mu      sync.RWMutex
+	version int
+	entries map[string]IdTagInfo
+}
+
+// NewMemoryAuthStore creates an empty in-memory AuthorizationStore at version 0.
+func NewMemoryAuthStore() *MemoryAuthStore {
+	return &MemoryAuthStore{entries: make(map[string]IdTagInfo)}
+}
+
+// Get implements AuthorizationStore.
+func (s *MemoryAuthStore) Get(idTag string) (IdTagInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.entries[idTag]
+	return info, ok
+}
+
+// Put implements AuthorizationStore.
+func (s *MemoryAuthStore) Put(idTag string, info IdTagInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[idTag] = info
+}
+
+// Version implements AuthorizationStore.
+func (s *MemoryAuthStore) Version() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// ReplaceAll implements AuthorizationStore.
+func (s *MemoryAuthStore) ReplaceAll(version int, entries []AuthListEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]IdTagInfo, len(entries))
+	for _, e := range entries {
+		s.entries[e.IdTag] = e.IdTagInfo
+	}
+	s.version = version
+	return nil
+}
+
+// Update implements AuthorizationStore, rejecting any update whose version
+// is not exactly current+1.
+func (s *MemoryAuthStore) Update(version int, entries []AuthListEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version != s.version+1 {
+		return fmt.Errorf("ocpp: differential update version %d is not current version %d + 1", version, s.version)
+	}
+	for _, e := range entries {
+		s.entries[e.IdTag] = e.IdTagInfo
+	}
+	s.version = version
+	return nil
+}
+
+// SetAuthStore configures the AuthorizationStore consulted by Authorize,
+// and registers the CallHandler that applies an incoming SendLocalList CALL
+// to store. If never called, a MemoryAuthStore is used and SendLocalList is
+// answered with NotImplemented.
+func (c *WebSocketClient) SetAuthStore(store AuthorizationStore) {
+	c.authMu.Lock()
+	c.authStore = store
+	c.authMu.Unlock()
+	c.SetCallHandler("SendLocalList", func(payload json.RawMessage) (interface{}, error) {
+		req := SendLocalListRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return OnSendLocalList(store, req), nil
+	})
+}
+
+func (c *WebSocketClient) authorizationStore() AuthorizationStore {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.authStore == nil {
+		c.authStore = NewMemoryAuthStore()
+	}
+	return c.authStore
+}
+
+// authorizeWithCache authorizes idTag by calling remoteAuthorize, falling
+// back to store when the remote call fails (e.g. the connection is down).
+// Cached entries whose ExpiryDate has passed are treated as a cache miss.
+// Either way, if the resolved IdTagInfo carries a ParentIdTag, the cached
+// entry for that parent governs the returned status, per the group
+// authorization rules in the OCPP 1.6 spec.
+func authorizeWithCache(store AuthorizationStore, idTag string, remoteAuthorize func() (*AuthorizeResponse, error)) (*AuthorizeResponse, error) {
+	response, err := remoteAuthorize()
+	if err == nil {
+		store.Put(idTag, response.IdTagInfo)
+		return &AuthorizeResponse{IdTagInfo: resolveGroupAuth(store, response.IdTagInfo)}, nil
+	}
+
+	info, ok := store.Get(idTag)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: authorize %q: remote unavailable (%w) and no cache entry", idTag, err)
+	}
+	if info.ExpiryDate != nil {
+		if expiry, parseErr := time.Parse(time.RFC3339, *info.ExpiryDate); parseErr == nil && time.Now().After(expiry) {
+			return nil, fmt.Errorf("ocpp: authorize %q: remote unavailable (%w) and cache entry expired", idTag, err)
+		}
+	}
+	return &AuthorizeResponse{IdTagInfo: resolveGroupAuth(store, info)}, nil
+}
+
+// resolveGroupAuth returns info with Status replaced by the cached parent
+// idTag's Status when info.ParentIdTag is set and that parent is cached,
+// since a group idTag's own status is not authoritative.
+func resolveGroupAuth(store AuthorizationStore, info IdTagInfo) IdTagInfo {
+	if info.ParentIdTag == nil {
+		return info
+	}
+	parent, ok := store.Get(*info.ParentIdTag)
+	if !ok {
+		return info
+	}
+	info.Status = parent.Status
+	return info
+}
+
+// SendLocalList sends a SendLocalList CALL to the charge point and returns
+// its response. The central system keeps no copy of the pushed list.
+func (c *CentralSystem) SendLocalList(ctx context.Context, cpID string, request SendLocalListRequest) (*SendLocalListResponse, error) {
+	cp, ok := c.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	response := &SendLocalListResponse{}
+	if err := cp.Call(ctx, "SendLocalList", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetLocalListVersion sends a GetLocalListVersion CALL to the charge point.
+func (c *CentralSystem) GetLocalListVersion(ctx context.Context, cpID string) (*GetLocalListVersionResponse, error) {
+	cp, ok := c.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	response := &GetLocalListVersionResponse{}
+	if err := cp.Call(ctx, "GetLocalListVersion", GetLocalListVersionRequest{}, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// OnSendLocalList applies an incoming SendLocalList CALL to store, honoring
+// Full vs Differential semantics. WebSocketClient.SetAuthStore registers it
+// as the handler for SendLocalList CALLs received from the central system.
+func OnSendLocalList(store AuthorizationStore, request SendLocalListRequest) *SendLocalListResponse {
+	var err error
+	switch request.UpdateType {
+	case UpdateTypeFull:
+		err = store.ReplaceAll(request.ListVersion, request.LocalAuthorizationList)
+	case UpdateTypeDifferential:
+		err = store.Update(request.ListVersion, request.LocalAuthorizationList)
+	default:
+		return &SendLocalListResponse{Status: UpdateStatusNotSupported}
+	}
+	if err != nil {
+		return &SendLocalListResponse{Status: UpdateStatusVersionMismatch}
+	}
+	return &SendLocalListResponse{Status: UpdateStatusAccepted}
+}
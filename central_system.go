@@ -0,0 +1,584 @@
+// Package ocpp: Central System (server) role.
+//
+// CentralSystem accepts incoming OCPP-J WebSocket connections from charge
+// points and dispatches CALL messages to a CoreHandler. Unlike
+// WebSocketClient, which initiates calls, CentralSystem is primarily a
+// responder: its job is to make sure every CALL it receives gets a
+// CALLRESULT or CALLERROR, even when the handler or routing fails, so the
+// charge point on the other end never stalls waiting for a reply.
+
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// CoreHandler is implemented by callers to handle Core profile messages
+// initiated by a charge point. cpID is the {chargeBoxIdentity} the
+// connection was accepted under.
+type CoreHandler interface {
+	OnBootNotification(cpID string, req *BootNotificationRequest) (*BootNotificationResponse, error)
+	OnHeartbeat(cpID string, req *HeartbeatRequest) (*HeartbeatResponse, error)
+	OnAuthorize(cpID string, req *AuthorizeRequest) (*AuthorizeResponse, error)
+	OnStartTransaction(cpID string, req *StartTransactionRequest) (*StartTransactionResponse, error)
+	OnStopTransaction(cpID string, req *StopTransactionRequest) (*StopTransactionResponse, error)
+	OnMeterValues(cpID string, req *MeterValuesRequest) (*MeterValuesResponse, error)
+	OnStatusNotification(cpID string, req *StatusNotificationRequest) (*StatusNotificationResponse, error)
+	OnDataTransfer(cpID string, req *DataTransferRequest) (*DataTransferResponse, error)
+}
+
+// chargepointConn is a connected charge point's websocket session.
+type chargepointConn struct {
+	id        string
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	validator Validator
+
+	mu      sync.Mutex
+	pending map[string]*pendingCall
+}
+
+func (cp *chargepointConn) Call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	if err := cp.validator.Validate(request); err != nil {
+		return err
+	}
+
+	uniqueID, err := newUniqueID()
+	if err != nil {
+		return fmt.Errorf("ocpp: generate unique id: %w", err)
+	}
+	frame := []interface{}{messageTypeCall, uniqueID, action, request}
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("ocpp: marshal CALL: %w", err)
+	}
+
+	call := &pendingCall{response: response, done: make(chan error, 1)}
+	cp.mu.Lock()
+	cp.pending[uniqueID] = call
+	cp.mu.Unlock()
+
+	cp.writeMu.Lock()
+	err = cp.conn.WriteMessage(websocket.TextMessage, payload)
+	cp.writeMu.Unlock()
+	if err != nil {
+		cp.mu.Lock()
+		delete(cp.pending, uniqueID)
+		cp.mu.Unlock()
+		return fmt.Errorf("ocpp: write CALL: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultCallTimeout)
+		defer cancel()
+	}
+
+	select {
+	case err := <-call.done:
+		if err != nil {
+			return err
+		}
+		if verr := cp.validator.Validate(response); verr != nil {
+			return &OCPPError{Code: ErrorCodeProtocolError, Description: verr.Error()}
+		}
+		return nil
+	case <-ctx.Done():
+		cp.mu.Lock()
+		delete(cp.pending, uniqueID)
+		cp.mu.Unlock()
+		return fmt.Errorf("ocpp: call %q to %q timed out: %w", action, cp.id, ctx.Err())
+	}
+}
+
+// CentralSystem is the OCPP-J server role: it accepts connections from
+// charge points and dispatches their CALLs to a CoreHandler, and lets the
+// owning application push CALLs back down to a connected station.
+type CentralSystem struct {
+	logger    *zap.Logger
+	handler   CoreHandler
+	upgrader  websocket.Upgrader
+	validator Validator
+
+	mu           sync.RWMutex
+	chargepoints map[string]*chargepointConn
+}
+
+// NewCentralSystem creates a CentralSystem that dispatches incoming CALLs
+// to handler.
+func NewCentralSystem(handler CoreHandler, logger *zap.Logger) *CentralSystem {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &CentralSystem{
+		logger:       logger,
+		handler:      handler,
+		upgrader:     websocket.Upgrader{Subprotocols: []string{ocppSubprotocol}},
+		validator:    NewDefaultValidator(),
+		chargepoints: make(map[string]*chargepointConn),
+	}
+}
+
+// SetValidator overrides the Validator used to check CALLs received from
+// charge points and CALLs sent back to them. Pass WithoutValidation() to
+// disable validation entirely for stations that don't comply with the
+// OCPP 1.6 JSON schema.
+func (cs *CentralSystem) SetValidator(v Validator) {
+	cs.validator = v
+}
+
+// ChargepointByID returns the connection for a connected charge point, if any.
+func (cs *CentralSystem) ChargepointByID(cpID string) (*chargepointConn, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	cp, ok := cs.chargepoints[cpID]
+	return cp, ok
+}
+
+// ServeHTTP implements http.Handler, upgrading the connection and routing
+// on the final URL path segment as the {chargeBoxIdentity}.
+func (cs *CentralSystem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	cpID := segments[len(segments)-1]
+	if cpID == "" {
+		http.Error(w, "missing charge box identity", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := cs.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		cs.logger.Warn("ocpp: upgrade failed", zap.String("cpID", cpID), zap.Error(err))
+		return
+	}
+
+	cp := &chargepointConn{id: cpID, conn: conn, validator: cs.validator, pending: make(map[string]*pendingCall)}
+	cs.mu.Lock()
+	cs.chargepoints[cpID] = cp
+	cs.mu.Unlock()
+
+	cs.logger.Info("ocpp: charge point connected", zap.String("cpID", cpID))
+	go cs.readLoop(cp)
+}
+
+func (cs *CentralSystem) readLoop(cp *chargepointConn) {
+	defer func() {
+		cs.mu.Lock()
+		// Only remove the registry entry if it still points at this
+		// connection. If the charge point reconnected before this
+		// goroutine noticed its read had failed, ServeHTTP will have
+		// already replaced it with a newer chargepointConn, and deleting
+		// unconditionally here would evict the live connection instead.
+		if cs.chargepoints[cp.id] == cp {
+			delete(cs.chargepoints, cp.id)
+		}
+		cs.mu.Unlock()
+		cp.conn.Close()
+		cs.logger.Info("ocpp: charge point disconnected", zap.String("cpID", cp.id))
+	}()
+
+	for {
+		_, raw, err := cp.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		cs.dispatch(cp, raw)
+	}
+}
+
+func (cs *CentralSystem) dispatch(cp *chargepointConn, raw []byte) {
+	var frame []json.RawMessage
+	if err := json.Unmarshal(raw, &frame); err != nil || len(frame) < 2 {
+		cs.logger.Warn("ocpp: malformed frame", zap.String("cpID", cp.id), zap.ByteString("raw", raw))
+		return
+	}
+
+	var messageType int
+	json.Unmarshal(frame[0], &messageType)
+
+	var uniqueID string
+	json.Unmarshal(frame[1], &uniqueID)
+
+	switch messageType {
+	case messageTypeCall:
+		if len(frame) < 4 {
+			cs.logger.Warn("ocpp: malformed CALL", zap.String("cpID", cp.id))
+			return
+		}
+		var action string
+		json.Unmarshal(frame[2], &action)
+		cs.handleCall(cp, uniqueID, action, frame[3])
+	case messageTypeCallResult, messageTypeCallError:
+		cp.mu.Lock()
+		call, ok := cp.pending[uniqueID]
+		if ok {
+			delete(cp.pending, uniqueID)
+		}
+		cp.mu.Unlock()
+		if !ok {
+			return
+		}
+		if messageType == messageTypeCallResult {
+			call.done <- json.Unmarshal(frame[2], call.response)
+		} else {
+			ocppErr := &OCPPError{}
+			if len(frame) >= 4 {
+				json.Unmarshal(frame[2], &ocppErr.Code)
+				json.Unmarshal(frame[3], &ocppErr.Description)
+			}
+			if len(frame) > 4 {
+				ocppErr.Details = frame[4]
+			}
+			call.done <- ocppErr
+		}
+	}
+}
+
+// handleCall dispatches a single CALL payload to the handler and always
+// answers with either a CALLRESULT or a CALLERROR. If routing or the
+// handler itself fails, a conservative default response is sent instead of
+// dropping the message, so the charge point isn't left waiting.
+func (cs *CentralSystem) handleCall(cp *chargepointConn, uniqueID, action string, payload json.RawMessage) {
+	var response interface{}
+	var err error
+
+	switch action {
+	case "BootNotification":
+		req := &BootNotificationRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnBootNotification(cp.id, req)
+		if err != nil {
+			response = &BootNotificationResponse{Status: RegistrationStatusPending, Interval: 60}
+			err = nil
+		}
+	case "Heartbeat":
+		req := &HeartbeatRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnHeartbeat(cp.id, req)
+		if err != nil {
+			response = &HeartbeatResponse{CurrentTime: time.Now().UTC().Format(time.RFC3339)}
+			err = nil
+		}
+	case "Authorize":
+		req := &AuthorizeRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnAuthorize(cp.id, req)
+		if err != nil {
+			response = &AuthorizeResponse{IdTagInfo: IdTagInfo{Status: AuthorizationStatusBlocked}}
+			err = nil
+		}
+	case "StartTransaction":
+		req := &StartTransactionRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnStartTransaction(cp.id, req)
+		if err != nil {
+			response = &StartTransactionResponse{}
+			err = nil
+		}
+	case "StopTransaction":
+		req := &StopTransactionRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnStopTransaction(cp.id, req)
+		if err != nil {
+			response = &StopTransactionResponse{Status: TransactionEventStatusAccepted}
+			err = nil
+		}
+	case "MeterValues":
+		req := &MeterValuesRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnMeterValues(cp.id, req)
+		if err != nil {
+			response = &MeterValuesResponse{Status: RegistrationStatusAccepted}
+			err = nil
+		}
+	case "StatusNotification":
+		req := &StatusNotificationRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnStatusNotification(cp.id, req)
+		if err != nil {
+			response = &StatusNotificationResponse{}
+			err = nil
+		}
+	case "DataTransfer":
+		req := &DataTransferRequest{}
+		json.Unmarshal(payload, req)
+		if verr := cs.validator.Validate(req); verr != nil {
+			cs.sendCallError(cp, uniqueID, ErrorCodeProtocolError, verr.Error())
+			return
+		}
+		response, err = cs.handler.OnDataTransfer(cp.id, req)
+		if err != nil {
+			response = &DataTransferResponse{Status: DataTransferStatusRejected}
+			err = nil
+		}
+	default:
+		cs.sendCallError(cp, uniqueID, ErrorCodeNotImplemented, fmt.Sprintf("action %q is not supported", action))
+		return
+	}
+
+	if verr := cs.validator.Validate(response); verr != nil {
+		cs.logger.Warn("ocpp: handler response failed validation", zap.String("cpID", cp.id), zap.String("action", action), zap.Error(verr))
+	}
+	cs.sendCallResult(cp, uniqueID, response)
+}
+
+func (cs *CentralSystem) sendCallResult(cp *chargepointConn, uniqueID string, response interface{}) {
+	frame := []interface{}{messageTypeCallResult, uniqueID, response}
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		cs.logger.Error("ocpp: marshal CALLRESULT", zap.Error(err))
+		return
+	}
+	cp.writeMu.Lock()
+	defer cp.writeMu.Unlock()
+	if err := cp.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		cs.logger.Warn("ocpp: write CALLRESULT", zap.String("cpID", cp.id), zap.Error(err))
+	}
+}
+
+func (cs *CentralSystem) sendCallError(cp *chargepointConn, uniqueID string, code ErrorCode, description string) {
+	frame := []interface{}{messageTypeCallError, uniqueID, code, description, json.RawMessage("{}")}
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		cs.logger.Error("ocpp: marshal CALLERROR", zap.Error(err))
+		return
+	}
+	cp.writeMu.Lock()
+	defer cp.writeMu.Unlock()
+	if err := cp.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		cs.logger.Warn("ocpp: write CALLERROR", zap.String("cpID", cp.id), zap.Error(err))
+	}
+}
+
+// RemoteStartTransaction sends a RemoteStartTransaction CALL to cpID.
+func (cs *CentralSystem) RemoteStartTransaction(ctx context.Context, cpID string, connectorID int, idTag string) (*RemoteStartTransactionResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := RemoteStartTransactionRequest{ConnectorId: connectorID, IdTag: idTag}
+	response := &RemoteStartTransactionResponse{}
+	if err := cp.Call(ctx, "RemoteStartTransaction", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RemoteStopTransaction sends a RemoteStopTransaction CALL to cpID.
+func (cs *CentralSystem) RemoteStopTransaction(ctx context.Context, cpID string, transactionID int) (*RemoteStopTransactionResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := RemoteStopTransactionRequest{TransactionId: transactionID}
+	response := &RemoteStopTransactionResponse{}
+	if err := cp.Call(ctx, "RemoteStopTransaction", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Reset sends a Reset CALL to cpID.
+func (cs *CentralSystem) Reset(ctx context.Context, cpID string, resetType ResetType) (*ResetResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := ResetRequest{Type: resetType}
+	response := &ResetResponse{}
+	if err := cp.Call(ctx, "Reset", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// UnlockConnector sends an UnlockConnector CALL to cpID.
+func (cs *CentralSystem) UnlockConnector(ctx context.Context, cpID string, connectorID int) (*UnlockConnectorResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := UnlockConnectorRequest{ConnectorId: connectorID}
+	response := &UnlockConnectorResponse{}
+	if err := cp.Call(ctx, "UnlockConnector", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ChangeConfiguration sends a ChangeConfiguration CALL to cpID.
+func (cs *CentralSystem) ChangeConfiguration(ctx context.Context, cpID, key, value string) (*ChangeConfigurationResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := ChangeConfigurationRequest{Key: key, Value: value}
+	response := &ChangeConfigurationResponse{}
+	if err := cp.Call(ctx, "ChangeConfiguration", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetConfiguration sends a GetConfiguration CALL to cpID.
+func (cs *CentralSystem) GetConfiguration(ctx context.Context, cpID string, keys []string) (*GetConfigurationResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := GetConfigurationRequest{Key: keys}
+	response := &GetConfigurationResponse{}
+	if err := cp.Call(ctx, "GetConfiguration", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RemoteStartTransactionRequest represents a RemoteStartTransaction request.
+type RemoteStartTransactionRequest struct {
+	ConnectorId int    `json:"connectorId,omitempty" validate:"omitempty,gte=0"`
+	IdTag       string `json:"idTag" validate:"required,max=20"`
+}
+
+// RemoteStartTransactionResponse represents a RemoteStartTransaction response.
+type RemoteStartTransactionResponse struct {
+	Status RemoteStartStopStatus `json:"status"`
+}
+
+// RemoteStopTransactionRequest represents a RemoteStopTransaction request.
+type RemoteStopTransactionRequest struct {
+	TransactionId int `json:"transactionId" validate:"required"`
+}
+
+// RemoteStopTransactionResponse represents a RemoteStopTransaction response.
+type RemoteStopTransactionResponse struct {
+	Status RemoteStartStopStatus `json:"status"`
+}
+
+// RemoteStartStopStatus represents the status returned for remote start/stop requests.
+type RemoteStartStopStatus string
+
+const (
+	RemoteStartStopStatusAccepted RemoteStartStopStatus = "Accepted"
+	RemoteStartStopStatusRejected RemoteStartStopStatus = "Rejected"
+)
+
+// ResetType represents the type of reset requested.
+type ResetType string
+
+const (
+	ResetTypeHard ResetType = "Hard"
+	ResetTypeSoft ResetType = "Soft"
+)
+
+// ResetRequest represents a Reset request.
+type ResetRequest struct {
+	Type ResetType `json:"type" validate:"required"`
+}
+
+// ResetResponse represents a Reset response.
+type ResetResponse struct {
+	Status ResetStatus `json:"status"`
+}
+
+// ResetStatus represents the status returned for a Reset request.
+type ResetStatus string
+
+const (
+	ResetStatusAccepted ResetStatus = "Accepted"
+	ResetStatusRejected ResetStatus = "Rejected"
+)
+
+// UnlockConnectorRequest represents an UnlockConnector request.
+type UnlockConnectorRequest struct {
+	ConnectorId int `json:"connectorId" validate:"required,gte=0"`
+}
+
+// UnlockConnectorResponse represents an UnlockConnector response.
+type UnlockConnectorResponse struct {
+	Status UnlockStatus `json:"status"`
+}
+
+// UnlockStatus represents the status returned for an UnlockConnector request.
+type UnlockStatus string
+
+const (
+	UnlockStatusUnlocked     UnlockStatus = "Unlocked"
+	UnlockStatusUnlockFailed UnlockStatus = "UnlockFailed"
+	UnlockStatusNotSupported UnlockStatus = "NotSupported"
+)
+
+// ChangeConfigurationRequest represents a ChangeConfiguration request.
+type ChangeConfigurationRequest struct {
+	Key   string `json:"key" validate:"required,max=50"`
+	Value string `json:"value" validate:"required,max=500"`
+}
+
+// ChangeConfigurationResponse represents a ChangeConfiguration response.
+type ChangeConfigurationResponse struct {
+	Status ConfigurationStatus `json:"status"`
+}
+
+// ConfigurationStatus represents the status returned for a ChangeConfiguration request.
+type ConfigurationStatus string
+
+const (
+	ConfigurationStatusAccepted       ConfigurationStatus = "Accepted"
+	ConfigurationStatusRejected       ConfigurationStatus = "Rejected"
+	ConfigurationStatusRebootRequired ConfigurationStatus = "RebootRequired"
+	ConfigurationStatusNotSupported   ConfigurationStatus = "NotSupported"
+)
+
+// GetConfigurationRequest represents a GetConfiguration request.
+type GetConfigurationRequest struct {
+	Key []string `json:"key,omitempty" validate:"omitempty,dive,max=50"`
+}
+
+// GetConfigurationResponse represents a GetConfiguration response.
+type GetConfigurationResponse struct {
+	ConfigurationKey []KeyValue `json:"configurationKey,omitempty"`
+	UnknownKey       []string   `json:"unknownKey,omitempty"`
+}
+
+// KeyValue represents a single configuration key/value pair.
+type KeyValue struct {
+	Key      string `json:"key"`
+	Readonly bool   `json:"readonly"`
+	Value    string `json:"value,omitempty"`
+}
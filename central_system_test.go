@@ -0,0 +1,193 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stubCoreHandler implements CoreHandler with fixed responses, for tests
+// that only care about CentralSystem's dispatch/framing behavior.
+type stubCoreHandler struct {
+	bootResponse *BootNotificationResponse
+}
+
+func (h *stubCoreHandler) OnBootNotification(cpID string, req *BootNotificationRequest) (*BootNotificationResponse, error) {
+	if h.bootResponse != nil {
+		return h.bootResponse, nil
+	}
+	return &BootNotificationResponse{Status: RegistrationStatusAccepted}, nil
+}
+func (h *stubCoreHandler) OnHeartbeat(cpID string, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return &HeartbeatResponse{}, nil
+}
+func (h *stubCoreHandler) OnAuthorize(cpID string, req *AuthorizeRequest) (*AuthorizeResponse, error) {
+	return &AuthorizeResponse{}, nil
+}
+func (h *stubCoreHandler) OnStartTransaction(cpID string, req *StartTransactionRequest) (*StartTransactionResponse, error) {
+	return &StartTransactionResponse{}, nil
+}
+func (h *stubCoreHandler) OnStopTransaction(cpID string, req *StopTransactionRequest) (*StopTransactionResponse, error) {
+	return &StopTransactionResponse{}, nil
+}
+func (h *stubCoreHandler) OnMeterValues(cpID string, req *MeterValuesRequest) (*MeterValuesResponse, error) {
+	return &MeterValuesResponse{}, nil
+}
+func (h *stubCoreHandler) OnStatusNotification(cpID string, req *StatusNotificationRequest) (*StatusNotificationResponse, error) {
+	return &StatusNotificationResponse{}, nil
+}
+func (h *stubCoreHandler) OnDataTransfer(cpID string, req *DataTransferRequest) (*DataTransferResponse, error) {
+	return &DataTransferResponse{}, nil
+}
+
+// dialChargePoint starts an httptest server around cs and dials it as
+// charge point cpID, returning both so the caller can exercise the wire
+// protocol exactly as a real charge point would.
+func dialChargePoint(t *testing.T, cs *CentralSystem, cpID string) (*httptest.Server, *websocket.Conn) {
+	t.Helper()
+	server := httptest.NewServer(cs)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/" + cpID
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		server.Close()
+		t.Fatalf("dial: %v", err)
+	}
+	return server, conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) []json.RawMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, raw, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	var frame []json.RawMessage
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		t.Fatalf("unmarshal frame %s: %v", raw, err)
+	}
+	return frame
+}
+
+func TestCentralSystemDispatchRoutesCallToHandler(t *testing.T) {
+	cs := NewCentralSystem(&stubCoreHandler{bootResponse: &BootNotificationResponse{Status: RegistrationStatusAccepted, Interval: 300}}, nil)
+	server, conn := dialChargePoint(t, cs, "CP1")
+	defer server.Close()
+	defer conn.Close()
+
+	req, _ := json.Marshal([]interface{}{messageTypeCall, "1", "BootNotification", BootNotificationRequest{ChargeBoxIdentity: "CP1"}})
+	if err := conn.WriteMessage(websocket.TextMessage, req); err != nil {
+		t.Fatalf("write CALL: %v", err)
+	}
+
+	frame := readFrame(t, conn)
+	var messageType int
+	json.Unmarshal(frame[0], &messageType)
+	if messageType != messageTypeCallResult {
+		t.Fatalf("expected CALLRESULT, got message type %d", messageType)
+	}
+
+	var response BootNotificationResponse
+	if err := json.Unmarshal(frame[2], &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Status != RegistrationStatusAccepted || response.Interval != 300 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+}
+
+func TestCentralSystemDispatchAnswersUnknownActionWithCallError(t *testing.T) {
+	cs := NewCentralSystem(&stubCoreHandler{}, nil)
+	server, conn := dialChargePoint(t, cs, "CP1")
+	defer server.Close()
+	defer conn.Close()
+
+	req, _ := json.Marshal([]interface{}{messageTypeCall, "1", "SomeUnsupportedAction", map[string]interface{}{}})
+	if err := conn.WriteMessage(websocket.TextMessage, req); err != nil {
+		t.Fatalf("write CALL: %v", err)
+	}
+
+	frame := readFrame(t, conn)
+	var messageType int
+	json.Unmarshal(frame[0], &messageType)
+	if messageType != messageTypeCallError {
+		t.Fatalf("expected CALLERROR, got message type %d", messageType)
+	}
+
+	var code ErrorCode
+	json.Unmarshal(frame[2], &code)
+	if code != ErrorCodeNotImplemented {
+		t.Fatalf("expected NotImplemented, got %q", code)
+	}
+}
+
+func TestCentralSystemDispatchAnswersInvalidRequestWithCallError(t *testing.T) {
+	cs := NewCentralSystem(&stubCoreHandler{}, nil)
+	server, conn := dialChargePoint(t, cs, "CP1")
+	defer server.Close()
+	defer conn.Close()
+
+	// BootNotificationRequest.ChargeBoxIdentity is required; omit it.
+	req, _ := json.Marshal([]interface{}{messageTypeCall, "1", "BootNotification", BootNotificationRequest{}})
+	if err := conn.WriteMessage(websocket.TextMessage, req); err != nil {
+		t.Fatalf("write CALL: %v", err)
+	}
+
+	frame := readFrame(t, conn)
+	var messageType int
+	json.Unmarshal(frame[0], &messageType)
+	if messageType != messageTypeCallError {
+		t.Fatalf("expected CALLERROR, got message type %d", messageType)
+	}
+
+	var code ErrorCode
+	json.Unmarshal(frame[2], &code)
+	if code != ErrorCodeProtocolError {
+		t.Fatalf("expected ProtocolError, got %q", code)
+	}
+}
+
+// TestCentralSystemReadLoopDoesNotEvictReconnectedChargePoint exercises the
+// readLoop cleanup guard directly: a stale connection's readLoop shouldn't
+// remove a newer chargepointConn that ServeHTTP already installed for the
+// same id (the fast-reconnect race).
+func TestCentralSystemReadLoopDoesNotEvictReconnectedChargePoint(t *testing.T) {
+	cs := NewCentralSystem(&stubCoreHandler{}, nil)
+
+	staleServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close() // fail the client's next ReadMessage immediately
+	}))
+	defer staleServer.Close()
+
+	staleWSURL := "ws" + strings.TrimPrefix(staleServer.URL, "http") + "/CP1"
+	staleConn, _, err := websocket.DefaultDialer.Dial(staleWSURL, nil)
+	if err != nil {
+		t.Fatalf("dial stale connection: %v", err)
+	}
+	defer staleConn.Close()
+	cpStale := &chargepointConn{id: "CP1", conn: staleConn, validator: cs.validator, pending: make(map[string]*pendingCall)}
+
+	// cpLive simulates the reconnected charge point ServeHTTP already
+	// registered under the same id while cpStale's readLoop was still
+	// blocked on its doomed ReadMessage call.
+	cpLive := &chargepointConn{id: "CP1", validator: cs.validator, pending: make(map[string]*pendingCall)}
+	cs.mu.Lock()
+	cs.chargepoints["CP1"] = cpLive
+	cs.mu.Unlock()
+
+	cs.readLoop(cpStale) // returns as soon as staleConn's read fails
+
+	cp, ok := cs.ChargepointByID("CP1")
+	if !ok || cp != cpLive {
+		t.Fatal("readLoop's cleanup evicted the reconnected charge point")
+	}
+}
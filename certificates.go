@@ -0,0 +1,540 @@
+// Package ocpp: OCPP 1.6 Security Extensions.
+//
+// Implements the certificate-management message set (SignCertificate,
+// CertificateSigned, InstallCertificate, DeleteCertificate,
+// GetInstalledCertificateIds) and the signed firmware variants
+// (SignedUpdateFirmware, SignedFirmwareStatusNotification), plus a
+// CertificateStore for persisting trust anchors and installed certs.
+//
+// SignCertificate's flow is: generate a local keypair, build a CSR from it,
+// send SignCertificateRequest, then on the matching CertificateSigned CALL
+// install the returned certificate via CertificateStore and rotate the
+// keypair used by the next TLS reconnect — in-flight transactions are left
+// alone since they run over the existing connection.
+
+package ocpp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sync"
+)
+
+// CertificateStore persists the trust anchors and installed certificates
+// used by the Security Extensions profile. Implementations must be safe
+// for concurrent use.
+type CertificateStore interface {
+	// InstallCA adds a trusted CA certificate (PEM-encoded) under certType.
+	InstallCA(certType CertificateUseType, pemCert []byte) error
+	// InstalledCertificateIds returns the hash data for installed certs of certType.
+	InstalledCertificateIds(certType CertificateUseType) ([]CertificateHashData, error)
+	// DeleteCertificate removes the certificate identified by hashData.
+	DeleteCertificate(hashData CertificateHashData) error
+	// InstallLeaf installs the signed leaf certificate (and rotates the
+	// active keypair) after a successful SignCertificate round-trip.
+	InstallLeaf(pemCert []byte, key crypto.Signer) error
+	// ActiveLeaf returns the current leaf certificate and its key, for use
+	// in the TLS config applied on the next reconnect.
+	ActiveLeaf() (tls.Certificate, bool)
+}
+
+// MemoryCertificateStore is an in-memory CertificateStore, useful for
+// tests and for stations whose persistence is handled elsewhere.
+type MemoryCertificateStore struct {
+	mu    sync.RWMutex
+	cas   map[CertificateUseType][][]byte
+	leaf  *tls.Certificate
+}
+
+// NewMemoryCertificateStore creates an empty in-memory CertificateStore.
+func NewMemoryCertificateStore() *MemoryCertificateStore {
+	return &MemoryCertificateStore{cas: make(map[CertificateUseType][][]byte)}
+}
+
+// InstallCA implements CertificateStore.
+func (s *MemoryCertificateStore) InstallCA(certType CertificateUseType, pemCert []byte) error {
+	block, _ := pem.Decode(pemCert)
+	if block == nil {
+		return fmt.Errorf("ocpp: no PEM block found")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return fmt.Errorf("ocpp: parse CA certificate: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cas[certType] = append(s.cas[certType], pemCert)
+	return nil
+}
+
+// InstalledCertificateIds implements CertificateStore.
+func (s *MemoryCertificateStore) InstalledCertificateIds(certType CertificateUseType) ([]CertificateHashData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []CertificateHashData
+	for _, pemCert := range s.cas[certType] {
+		block, _ := pem.Decode(pemCert)
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		out = append(out, hashDataFor(cert))
+	}
+	return out, nil
+}
+
+// DeleteCertificate implements CertificateStore.
+func (s *MemoryCertificateStore) DeleteCertificate(hashData CertificateHashData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for certType, certs := range s.cas {
+		remaining := certs[:0]
+		found := false
+		for _, pemCert := range certs {
+			block, _ := pem.Decode(pemCert)
+			if block == nil {
+				remaining = append(remaining, pemCert)
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err == nil && hashDataFor(cert) == hashData {
+				found = true
+				continue
+			}
+			remaining = append(remaining, pemCert)
+		}
+		s.cas[certType] = remaining
+		if found {
+			return nil
+		}
+	}
+	return fmt.Errorf("ocpp: certificate not found")
+}
+
+// InstallLeaf implements CertificateStore.
+func (s *MemoryCertificateStore) InstallLeaf(pemCert []byte, key crypto.Signer) error {
+	block, _ := pem.Decode(pemCert)
+	if block == nil {
+		return fmt.Errorf("ocpp: no PEM block found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("ocpp: parse leaf certificate: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaf = &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+	return nil
+}
+
+// ActiveLeaf implements CertificateStore.
+func (s *MemoryCertificateStore) ActiveLeaf() (tls.Certificate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.leaf == nil {
+		return tls.Certificate{}, false
+	}
+	return *s.leaf, true
+}
+
+// hashDataFor identifies cert by the SHA-256 of its issuer's DER-encoded
+// name and its serial number. IssuerKeyHash holds cert's AuthorityKeyId in
+// hex, not a SHA-256 of the issuer's public key.
+func hashDataFor(cert *x509.Certificate) CertificateHashData {
+	issuerNameHash := sha256.Sum256(cert.RawIssuer)
+	return CertificateHashData{
+		HashAlgorithm:  HashAlgorithmSHA256,
+		IssuerNameHash: fmt.Sprintf("%x", issuerNameHash),
+		IssuerKeyHash:  fmt.Sprintf("%x", cert.AuthorityKeyId),
+		SerialNumber:   cert.SerialNumber.String(),
+	}
+}
+
+// CertificateUseType represents which trust role a certificate is installed for.
+type CertificateUseType string
+
+const (
+	CertificateUseCentralSystemRootCertificate CertificateUseType = "CentralSystemRootCertificate"
+	CertificateUseManufacturerRootCertificate  CertificateUseType = "ManufacturerRootCertificate"
+)
+
+// HashAlgorithmType represents the hash algorithm used in CertificateHashData.
+type HashAlgorithmType string
+
+const (
+	HashAlgorithmSHA256 HashAlgorithmType = "SHA256"
+	HashAlgorithmSHA384 HashAlgorithmType = "SHA384"
+	HashAlgorithmSHA512 HashAlgorithmType = "SHA512"
+)
+
+// CertificateHashData identifies a certificate without transmitting it in full.
+type CertificateHashData struct {
+	HashAlgorithm  HashAlgorithmType `json:"hashAlgorithm" validate:"required"`
+	IssuerNameHash string            `json:"issuerNameHash" validate:"required,max=128"`
+	IssuerKeyHash  string            `json:"issuerKeyHash" validate:"required,max=128"`
+	SerialNumber   string            `json:"serialNumber" validate:"required,max=40"`
+}
+
+// GenericStatus is the shared Accepted/Rejected/Failed status vocabulary
+// used by several Security Extensions responses.
+type GenericStatus string
+
+const (
+	GenericStatusAccepted GenericStatus = "Accepted"
+	GenericStatusRejected GenericStatus = "Rejected"
+	GenericStatusFailed   GenericStatus = "Failed"
+)
+
+// SignCertificateRequest represents a SignCertificate request.
+type SignCertificateRequest struct {
+	CSR string `json:"csr" validate:"required,max=5500"`
+}
+
+// SignCertificateResponse represents a SignCertificate response.
+type SignCertificateResponse struct {
+	Status GenericStatus `json:"status"`
+}
+
+// CertificateSignedRequest represents a CertificateSigned request, the
+// CSMS's reply to a previously issued CSR.
+type CertificateSignedRequest struct {
+	CertificateChain string `json:"certificateChain" validate:"required,max=10000"`
+}
+
+// CertificateSignedResponse represents a CertificateSigned response.
+type CertificateSignedResponse struct {
+	Status GenericStatus `json:"status"`
+}
+
+// InstallCertificateRequest represents an InstallCertificate request.
+type InstallCertificateRequest struct {
+	CertificateType CertificateUseType `json:"certificateType" validate:"required"`
+	Certificate     string             `json:"certificate" validate:"required,max=5500"`
+}
+
+// InstallCertificateResponse represents an InstallCertificate response.
+type InstallCertificateResponse struct {
+	Status GenericStatus `json:"status"`
+}
+
+// DeleteCertificateRequest represents a DeleteCertificate request.
+type DeleteCertificateRequest struct {
+	CertificateHashData CertificateHashData `json:"certificateHashData" validate:"required"`
+}
+
+// DeleteCertificateStatus represents the response status for DeleteCertificate.
+type DeleteCertificateStatus string
+
+const (
+	DeleteCertificateStatusAccepted    DeleteCertificateStatus = "Accepted"
+	DeleteCertificateStatusFailed      DeleteCertificateStatus = "Failed"
+	DeleteCertificateStatusNotFound    DeleteCertificateStatus = "NotFound"
+)
+
+// DeleteCertificateResponse represents a DeleteCertificate response.
+type DeleteCertificateResponse struct {
+	Status DeleteCertificateStatus `json:"status"`
+}
+
+// GetInstalledCertificateIdsRequest represents a GetInstalledCertificateIds request.
+type GetInstalledCertificateIdsRequest struct {
+	CertificateType CertificateUseType `json:"certificateType,omitempty" validate:"omitempty"`
+}
+
+// GetInstalledCertificateIdsStatus represents the response status for GetInstalledCertificateIds.
+type GetInstalledCertificateIdsStatus string
+
+const (
+	GetInstalledCertificateIdsStatusAccepted GetInstalledCertificateIdsStatus = "Accepted"
+	GetInstalledCertificateIdsStatusNotFound GetInstalledCertificateIdsStatus = "NotFound"
+)
+
+// GetInstalledCertificateIdsResponse represents a GetInstalledCertificateIds response.
+type GetInstalledCertificateIdsResponse struct {
+	Status              GetInstalledCertificateIdsStatus `json:"status"`
+	CertificateHashData []CertificateHashData             `json:"certificateHashData,omitempty"`
+}
+
+// SignedUpdateFirmwareRequest represents a SignedUpdateFirmware request.
+type SignedUpdateFirmwareRequest struct {
+	RequestId int                 `json:"requestId" validate:"gte=0"`
+	Firmware  SignedFirmwareImage `json:"firmware" validate:"required"`
+	Retries   int                 `json:"retries,omitempty" validate:"omitempty,gte=0"`
+}
+
+// SignedFirmwareImage describes a firmware image signed by the manufacturer.
+type SignedFirmwareImage struct {
+	Location           string `json:"location" validate:"required,max=512"`
+	Signature          string `json:"signature" validate:"required,max=344"`
+	SigningCertificate string `json:"signingCertificate" validate:"required,max=5500"`
+}
+
+// SignedUpdateFirmwareStatus represents the response status for SignedUpdateFirmware.
+type SignedUpdateFirmwareStatus string
+
+const (
+	SignedUpdateFirmwareStatusAccepted       SignedUpdateFirmwareStatus = "Accepted"
+	SignedUpdateFirmwareStatusRejected       SignedUpdateFirmwareStatus = "Rejected"
+	SignedUpdateFirmwareStatusInvalidCertificate SignedUpdateFirmwareStatus = "InvalidCertificate"
+)
+
+// SignedUpdateFirmwareResponse represents a SignedUpdateFirmware response.
+type SignedUpdateFirmwareResponse struct {
+	Status SignedUpdateFirmwareStatus `json:"status"`
+}
+
+// SignedFirmwareStatusNotificationRequest represents a
+// SignedFirmwareStatusNotification request.
+type SignedFirmwareStatusNotificationRequest struct {
+	Status    FirmwareStatus `json:"status" validate:"required"`
+	RequestId int            `json:"requestId" validate:"gte=0"`
+}
+
+// FirmwareStatus mirrors the unsigned firmware profile's status enum, kept
+// local to avoid an import cycle with the firmware sub-package.
+type FirmwareStatus string
+
+// SignedFirmwareStatusNotificationResponse represents a
+// SignedFirmwareStatusNotification response.
+type SignedFirmwareStatusNotificationResponse struct{}
+
+// CSRKeyType selects the key algorithm used when generating a CSR for SignCertificate.
+type CSRKeyType int
+
+const (
+	// CSRKeyECDSAP256 generates a P-256 ECDSA key (the default: small and fast).
+	CSRKeyECDSAP256 CSRKeyType = iota
+	// CSRKeyRSA2048 generates a 2048-bit RSA key.
+	CSRKeyRSA2048
+)
+
+// GenerateCSR creates a local keypair of the requested type and a PEM-encoded
+// PKCS#10 certificate signing request for commonName, for use with
+// WebSocketClient.SignCertificate.
+func GenerateCSR(keyType CSRKeyType, commonName string) (csrPEM []byte, key crypto.Signer, err error) {
+	switch keyType {
+	case CSRKeyRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocpp: generate key: %w", err)
+	}
+
+	template := x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: commonName},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	if keyType == CSRKeyRSA2048 {
+		template.SignatureAlgorithm = x509.SHA256WithRSA
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocpp: create CSR: %w", err)
+	}
+
+	csrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	return csrPEM, key, nil
+}
+
+// SignCertificate generates a CSR of the given key type, sends
+// SignCertificateRequest, and remembers the private key so the matching
+// CertificateSigned CALL (handled via HandleCertificateSigned) can install
+// the signed leaf and rotate the active keypair.
+func (c *WebSocketClient) SignCertificate(ctx context.Context, keyType CSRKeyType, commonName string, store CertificateStore) (*SignCertificateResponse, error) {
+	csrPEM, key, err := GenerateCSR(keyType, commonName)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.pendingCSRKey = key
+	c.mu.Unlock()
+
+	request := SignCertificateRequest{CSR: string(csrPEM)}
+	response := &SignCertificateResponse{}
+	if err := c.Call(ctx, "SignCertificate", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// HandleCertificateSigned installs the certificate chain from an incoming
+// CertificateSigned CALL using the key generated by the most recent
+// SignCertificate call, and rotates the client's TLS keypair so the next
+// reconnect uses it. In-flight transactions on the current connection are
+// unaffected.
+func (c *WebSocketClient) HandleCertificateSigned(req CertificateSignedRequest, store CertificateStore) *CertificateSignedResponse {
+	c.mu.Lock()
+	key := c.pendingCSRKey
+	c.pendingCSRKey = nil
+	c.mu.Unlock()
+
+	if key == nil {
+		return &CertificateSignedResponse{Status: GenericStatusRejected}
+	}
+
+	if err := store.InstallLeaf([]byte(req.CertificateChain), key); err != nil {
+		c.logger.Error("ocpp: install signed certificate failed")
+		return &CertificateSignedResponse{Status: GenericStatusRejected}
+	}
+
+	if leaf, ok := store.ActiveLeaf(); ok {
+		// Clone the dialer's existing TLSClientConfig rather than building
+		// a fresh one, so a RootCAs pool installed via WithServerCA isn't
+		// silently dropped on every certificate rotation.
+		var tlsConfig *tls.Config
+		if c.dialer != nil && c.dialer.TLSClientConfig != nil {
+			tlsConfig = c.dialer.TLSClientConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		tlsConfig.Certificates = []tls.Certificate{leaf}
+		c.SetTLSConfig(tlsConfig)
+	}
+
+	return &CertificateSignedResponse{Status: GenericStatusAccepted}
+}
+
+// SetCertificateStore registers CallHandlers for the certificate-management
+// CALLs the CSMS can send to a charge point (CertificateSigned,
+// InstallCertificate, DeleteCertificate, GetInstalledCertificateIds),
+// wiring HandleCertificateSigned and store into the inbound CALL dispatch.
+func (c *WebSocketClient) SetCertificateStore(store CertificateStore) {
+	c.SetCallHandler("CertificateSigned", func(payload json.RawMessage) (interface{}, error) {
+		req := CertificateSignedRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return c.HandleCertificateSigned(req, store), nil
+	})
+
+	c.SetCallHandler("InstallCertificate", func(payload json.RawMessage) (interface{}, error) {
+		req := InstallCertificateRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		if err := store.InstallCA(req.CertificateType, []byte(req.Certificate)); err != nil {
+			return &InstallCertificateResponse{Status: GenericStatusRejected}, nil
+		}
+		return &InstallCertificateResponse{Status: GenericStatusAccepted}, nil
+	})
+
+	c.SetCallHandler("DeleteCertificate", func(payload json.RawMessage) (interface{}, error) {
+		req := DeleteCertificateRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		if err := store.DeleteCertificate(req.CertificateHashData); err != nil {
+			return &DeleteCertificateResponse{Status: DeleteCertificateStatusNotFound}, nil
+		}
+		return &DeleteCertificateResponse{Status: DeleteCertificateStatusAccepted}, nil
+	})
+
+	c.SetCallHandler("GetInstalledCertificateIds", func(payload json.RawMessage) (interface{}, error) {
+		req := GetInstalledCertificateIdsRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		ids, err := store.InstalledCertificateIds(req.CertificateType)
+		if err != nil {
+			return &GetInstalledCertificateIdsResponse{Status: GetInstalledCertificateIdsStatusNotFound}, nil
+		}
+		return &GetInstalledCertificateIdsResponse{Status: GetInstalledCertificateIdsStatusAccepted, CertificateHashData: ids}, nil
+	})
+}
+
+// SignedUpdateFirmwareHandlerFunc handles an incoming SignedUpdateFirmware
+// CALL, e.g. to hand the signed image off to the firmware sub-package's
+// downloader after verifying SigningCertificate.
+type SignedUpdateFirmwareHandlerFunc func(req SignedUpdateFirmwareRequest) (*SignedUpdateFirmwareResponse, error)
+
+// SetSignedUpdateFirmwareHandler registers handler for inbound
+// SignedUpdateFirmware CALLs.
+func (c *WebSocketClient) SetSignedUpdateFirmwareHandler(handler SignedUpdateFirmwareHandlerFunc) {
+	c.SetCallHandler("SignedUpdateFirmware", func(payload json.RawMessage) (interface{}, error) {
+		req := SignedUpdateFirmwareRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return handler(req)
+	})
+}
+
+// InstallCertificate sends an InstallCertificate CALL to cpID.
+func (cs *CentralSystem) InstallCertificate(ctx context.Context, cpID string, certType CertificateUseType, pemCert string) (*InstallCertificateResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := InstallCertificateRequest{CertificateType: certType, Certificate: pemCert}
+	response := &InstallCertificateResponse{}
+	if err := cp.Call(ctx, "InstallCertificate", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DeleteCertificate sends a DeleteCertificate CALL to cpID.
+func (cs *CentralSystem) DeleteCertificate(ctx context.Context, cpID string, hashData CertificateHashData) (*DeleteCertificateResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := DeleteCertificateRequest{CertificateHashData: hashData}
+	response := &DeleteCertificateResponse{}
+	if err := cp.Call(ctx, "DeleteCertificate", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetInstalledCertificateIds sends a GetInstalledCertificateIds CALL to cpID.
+func (cs *CentralSystem) GetInstalledCertificateIds(ctx context.Context, cpID string, certType CertificateUseType) (*GetInstalledCertificateIdsResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	request := GetInstalledCertificateIdsRequest{CertificateType: certType}
+	response := &GetInstalledCertificateIdsResponse{}
+	if err := cp.Call(ctx, "GetInstalledCertificateIds", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SignedUpdateFirmware sends a SignedUpdateFirmware CALL to cpID.
+func (cs *CentralSystem) SignedUpdateFirmware(ctx context.Context, cpID string, request SignedUpdateFirmwareRequest) (*SignedUpdateFirmwareResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	response := &SignedUpdateFirmwareResponse{}
+	if err := cp.Call(ctx, "SignedUpdateFirmware", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
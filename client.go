@@ -9,11 +9,13 @@ package ocpp
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -28,9 +30,13 @@ var (
 
 // Client represents an OCPP client that communicates with a charge point.
 type Client struct {
-	endpoint string
-	client   *http.Client
-	logger   *zap.Logger
+	endpoint  string
+	client    *http.Client
+	logger    *zap.Logger
+	validator Validator
+
+	authMu    sync.Mutex
+	authStore AuthorizationStore
 }
 
 // NewClient creates a new OCPP client with the specified endpoint URL and optional logger.
@@ -39,9 +45,10 @@ func NewClient(endpoint string, logger *zap.Logger) *Client {
 		logger = zap.NewNop() // Default to no-op logger if not provided
 	}
 	return &Client{
-		endpoint: endpoint,
-		client:   DefaultHTTPClient,
-		logger:   logger,
+		endpoint:  endpoint,
+		client:    DefaultHTTPClient,
+		logger:    logger,
+		validator: NewDefaultValidator(),
 	}
 }
 
@@ -50,8 +57,44 @@ func (c *Client) SetHTTPClient(client *http.Client) {
 	c.client = client
 }
 
+// SetValidator overrides the Validator used to check outbound requests and
+// inbound responses. Pass WithoutValidation() to disable validation
+// entirely for stations that don't comply with the OCPP 1.6 JSON schema.
+func (c *Client) SetValidator(v Validator) {
+	c.validator = v
+}
+
+// SetAuthStore configures the AuthorizationStore consulted by Authorize
+// when the remote call fails. If never called, a MemoryAuthStore is used.
+func (c *Client) SetAuthStore(store AuthorizationStore) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	c.authStore = store
+}
+
+func (c *Client) authorizationStore() AuthorizationStore {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.authStore == nil {
+		c.authStore = NewMemoryAuthStore()
+	}
+	return c.authStore
+}
+
+// Call implements Transport for Client, so the legacy XML/SOAP binding can
+// be used interchangeably with WebSocketClient wherever Transport is
+// accepted. ctx is not currently honored by the underlying HTTP call.
+func (c *Client) Call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	return c.sendRequest(action, request, response)
+}
+
 // sendRequest sends a request to the OCPP server and parses the response.
 func (c *Client) sendRequest(action string, request interface{}, response interface{}) error {
+	if err := c.validator.Validate(request); err != nil {
+		c.logger.Error("request failed validation", zap.String("action", action), zap.Error(err))
+		return err
+	}
+
 	requestXML, err := xml.Marshal(request)
 	if err != nil {
 		c.logger.Error("failed to marshal request XML", zap.Error(err))
@@ -83,6 +126,11 @@ func (c *Client) sendRequest(action string, request interface{}, response interf
 		return err
 	}
 
+	if err := c.validator.Validate(response); err != nil {
+		c.logger.Error("response failed validation", zap.String("action", action), zap.Error(err))
+		return &OCPPError{Code: ErrorCodeProtocolError, Description: err.Error()}
+	}
+
 	return nil
 }
 
@@ -108,16 +156,22 @@ func (c *Client) Heartbeat() (*HeartbeatResponse, error) {
 	return response, nil
 }
 
-// Authorize sends an Authorize request to the charge point.
+// Authorize sends an Authorize request to the charge point, consulting the
+// configured AuthorizationStore (see SetAuthStore) when the remote call
+// fails, and caching every successful response so the station stays
+// authorized offline. Group idTags (ParentIdTag set) are resolved against
+// the cached parent entry.
 func (c *Client) Authorize(idTag string) (*AuthorizeResponse, error) {
-	request := AuthorizeRequest{
-		IdTag: idTag,
-	}
-	response := &AuthorizeResponse{}
-	if err := c.sendRequest("Authorize", request, response); err != nil {
-		return nil, err
-	}
-	return response, nil
+	return authorizeWithCache(c.authorizationStore(), idTag, func() (*AuthorizeResponse, error) {
+		request := AuthorizeRequest{
+			IdTag: idTag,
+		}
+		response := &AuthorizeResponse{}
+		if err := c.sendRequest("Authorize", request, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	})
 }
 
 // StartTransaction sends a StartTransaction request to the charge point.
@@ -191,13 +245,13 @@ type MeterValue struct {
 
 // BootNotificationRequest represents a BootNotification request in OCPP.
 type BootNotificationRequest struct {
-	ChargeBoxIdentity string `xml:"chargeBoxIdentity"`
+	ChargeBoxIdentity string `xml:"chargeBoxIdentity" validate:"required,max=20"`
 }
 
 // BootNotificationResponse represents a BootNotification response in OCPP.
 type BootNotificationResponse struct {
-	Status      RegistrationStatus `xml:"status"`
-	CurrentTime string             `xml:"currentTime,omitempty"`
+	Status      RegistrationStatus `xml:"status" validate:"required"`
+	CurrentTime string             `xml:"currentTime,omitempty" validate:"omitempty,iso8601"`
 	Interval    int                `xml:"interval,omitempty"`
 	Heartbeat   int                `xml:"heartbeat,omitempty"`
 }
@@ -212,7 +266,7 @@ type HeartbeatResponse struct {
 
 // AuthorizeRequest represents an Authorize request in OCPP.
 type AuthorizeRequest struct {
-	IdTag string `xml:"idTag"`
+	IdTag string `xml:"idTag" validate:"required,max=20"`
 }
 
 // AuthorizeResponse represents an Authorize response in OCPP.
@@ -229,8 +283,8 @@ type IdTagInfo struct {
 
 // StartTransactionRequest represents a StartTransaction request in OCPP.
 type StartTransactionRequest struct {
-	ConnectorId int    `xml:"connectorId"`
-	IdTag       string `xml:"idTag"`
+	ConnectorId int    `xml:"connectorId" validate:"required,gte=0"`
+	IdTag       string `xml:"idTag" validate:"required,max=20"`
 }
 
 // StartTransactionResponse represents a StartTransaction response in OCPP.
@@ -240,7 +294,7 @@ type StartTransactionResponse struct {
 
 // StopTransactionRequest represents a StopTransaction request in OCPP.
 type StopTransactionRequest struct {
-	TransactionId int `xml:"transactionId"`
+	TransactionId int `xml:"transactionId" validate:"required"`
 }
 
 // StopTransactionResponse represents a StopTransaction response in OCPP.
@@ -248,6 +302,11 @@ type StopTransactionResponse struct {
 	Status TransactionEventStatus `xml:"status"`
 }
 
+// MeterValuesRequest represents a MeterValues request in OCPP.
+type MeterValuesRequest struct {
+	Values []MeterValue `xml:"meterValue" validate:"omitempty,dive"`
+}
+
 type MeterValuesResponse struct {
 	Status RegistrationStatus `xml:"status"`
 }
@@ -282,8 +341,8 @@ type StatusNotificationResponse struct {
 
 // DataTransferRequest represents a DataTransfer request in OCPP.
 type DataTransferRequest struct {
-	VendorId    string `xml:"vendorId"`
-	MessageData string `xml:"messageData"`
+	VendorId    string `xml:"vendorId" validate:"required,max=255"`
+	MessageData string `xml:"messageData" validate:"max=512"`
 }
 
 // DataTransferResponse represents a DataTransfer response in OCPP.
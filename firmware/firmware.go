@@ -0,0 +1,549 @@
+// Package firmware implements the OCPP 1.6 Firmware Management and
+// Diagnostics profile. It is kept separate from the core package because,
+// unlike Core, it is an optional profile: a charge point or central system
+// can support Core without ever dialing FirmwareStatusNotification.
+package firmware
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	ocpp "github.com/slimdestro/ocpp-go-client"
+)
+
+// FeatureNames lists the Action names this profile registers, for central
+// systems that dispatch on a feature-name whitelist.
+var FeatureNames = []string{
+	"UpdateFirmware",
+	"FirmwareStatusNotification",
+	"GetDiagnostics",
+	"DiagnosticsStatusNotification",
+}
+
+// FirmwareStatus represents the lifecycle of a firmware update.
+type FirmwareStatus string
+
+const (
+	FirmwareStatusDownloaded        FirmwareStatus = "Downloaded"
+	FirmwareStatusDownloadFailed    FirmwareStatus = "DownloadFailed"
+	FirmwareStatusDownloading       FirmwareStatus = "Downloading"
+	FirmwareStatusIdle              FirmwareStatus = "Idle"
+	FirmwareStatusInstallationFailed FirmwareStatus = "InstallationFailed"
+	FirmwareStatusInstalling        FirmwareStatus = "Installing"
+	FirmwareStatusInstalled         FirmwareStatus = "Installed"
+)
+
+// DiagnosticsStatus represents the lifecycle of a diagnostics upload.
+type DiagnosticsStatus string
+
+const (
+	DiagnosticsStatusIdle           DiagnosticsStatus = "Idle"
+	DiagnosticsStatusUploaded       DiagnosticsStatus = "Uploaded"
+	DiagnosticsStatusUploadFailed   DiagnosticsStatus = "UploadFailed"
+	DiagnosticsStatusUploading      DiagnosticsStatus = "Uploading"
+)
+
+// UpdateFirmwareRequest represents an UpdateFirmware request.
+type UpdateFirmwareRequest struct {
+	Location      string    `json:"location" validate:"required,max=512"`
+	Retries       int       `json:"retries,omitempty" validate:"omitempty,gte=0"`
+	RetrieveDate  time.Time `json:"retrieveDate" validate:"required"`
+	RetryInterval int       `json:"retryInterval,omitempty" validate:"omitempty,gte=0"`
+	// SHA256 is a non-standard extension used locally to verify the
+	// downloaded artifact; it is not sent over the wire.
+	SHA256 string `json:"-"`
+}
+
+// UpdateFirmwareResponse represents an UpdateFirmware response. OCPP 1.6
+// defines no payload fields for this response.
+type UpdateFirmwareResponse struct{}
+
+// FirmwareStatusNotificationRequest represents a FirmwareStatusNotification request.
+type FirmwareStatusNotificationRequest struct {
+	Status FirmwareStatus `json:"status" validate:"required"`
+}
+
+// FirmwareStatusNotificationResponse represents a FirmwareStatusNotification response.
+type FirmwareStatusNotificationResponse struct{}
+
+// GetDiagnosticsRequest represents a GetDiagnostics request.
+type GetDiagnosticsRequest struct {
+	Location      string     `json:"location" validate:"required,max=512"`
+	Retries       int        `json:"retries,omitempty" validate:"omitempty,gte=0"`
+	RetryInterval int        `json:"retryInterval,omitempty" validate:"omitempty,gte=0"`
+	StartTime     *time.Time `json:"startTime,omitempty"`
+	StopTime      *time.Time `json:"stopTime,omitempty"`
+}
+
+// GetDiagnosticsResponse represents a GetDiagnostics response.
+type GetDiagnosticsResponse struct {
+	FileName string `json:"fileName,omitempty"`
+}
+
+// DiagnosticsStatusNotificationRequest represents a DiagnosticsStatusNotification request.
+type DiagnosticsStatusNotificationRequest struct {
+	Status DiagnosticsStatus `json:"status" validate:"required"`
+}
+
+// DiagnosticsStatusNotificationResponse represents a DiagnosticsStatusNotification response.
+type DiagnosticsStatusNotificationResponse struct{}
+
+// FirmwareManager downloads and installs firmware on behalf of a charge
+// point, emitting FirmwareStatusNotification CALLs at each stage transition.
+type FirmwareManager struct {
+	transport ocpp.Transport
+	client    *http.Client
+}
+
+// NewFirmwareManager creates a FirmwareManager that reports status over transport.
+func NewFirmwareManager(transport ocpp.Transport) *FirmwareManager {
+	return &FirmwareManager{
+		transport: transport,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Update downloads the artifact named in req.Location, optionally verifying
+// its SHA-256 checksum, and writes it to destPath. It emits
+// FirmwareStatusNotification calls for Downloading/Downloaded/DownloadFailed
+// as the download progresses. Installation itself is out of scope here
+// (it is device-specific); callers move to FirmwareStatusInstalling /
+// FirmwareStatusInstalled / FirmwareStatusInstallationFailed once they have
+// applied the downloaded image.
+func (m *FirmwareManager) Update(ctx context.Context, req UpdateFirmwareRequest, destPath string) error {
+	m.notify(ctx, FirmwareStatusDownloading)
+
+	retries := req.Retries
+	if retries <= 0 {
+		retries = 1
+	}
+	interval := time.Duration(req.RetryInterval) * time.Second
+
+	var lastErr error
+	for attempt := 0; attempt < retries; attempt++ {
+		if attempt > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+		if lastErr = m.download(ctx, req.Location, destPath); lastErr == nil {
+			break
+		}
+	}
+	if lastErr != nil {
+		m.notify(ctx, FirmwareStatusDownloadFailed)
+		return fmt.Errorf("firmware: download %q: %w", req.Location, lastErr)
+	}
+
+	if req.SHA256 != "" {
+		if err := verifyChecksum(destPath, req.SHA256); err != nil {
+			m.notify(ctx, FirmwareStatusDownloadFailed)
+			return fmt.Errorf("firmware: checksum mismatch for %q: %w", destPath, err)
+		}
+	}
+
+	m.notify(ctx, FirmwareStatusDownloaded)
+	return nil
+}
+
+// NotifyInstalling, NotifyInstalled, and NotifyInstallationFailed let the
+// caller report the installation stages it owns.
+func (m *FirmwareManager) NotifyInstalling(ctx context.Context)        { m.notify(ctx, FirmwareStatusInstalling) }
+func (m *FirmwareManager) NotifyInstalled(ctx context.Context)         { m.notify(ctx, FirmwareStatusInstalled) }
+func (m *FirmwareManager) NotifyInstallationFailed(ctx context.Context) { m.notify(ctx, FirmwareStatusInstallationFailed) }
+
+// SetFirmwareManager registers a CallHandler on client so inbound
+// UpdateFirmware CALLs are acknowledged immediately (as the OCPP 1.6 spec
+// requires) and handed off to manager to download in the background,
+// reporting progress via FirmwareStatusNotification as it goes.
+func SetFirmwareManager(client *ocpp.WebSocketClient, manager *FirmwareManager, destPath string) {
+	client.SetCallHandler("UpdateFirmware", func(payload json.RawMessage) (interface{}, error) {
+		var req UpdateFirmwareRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		go manager.Update(context.Background(), req, destPath)
+		return &UpdateFirmwareResponse{}, nil
+	})
+}
+
+func (m *FirmwareManager) notify(ctx context.Context, status FirmwareStatus) {
+	request := FirmwareStatusNotificationRequest{Status: status}
+	response := &FirmwareStatusNotificationResponse{}
+	m.transport.Call(ctx, "FirmwareStatusNotification", request, response)
+}
+
+func (m *FirmwareManager) download(ctx context.Context, location, destPath string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid location: %w", err)
+	}
+
+	var body io.ReadCloser
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		body = resp.Body
+	case "ftp":
+		body, err = ftpGet(ctx, u)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	defer body.Close()
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, body)
+	return err
+}
+
+func verifyChecksum(path, wantHex string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if got != wantHex {
+		return fmt.Errorf("got %s, want %s", got, wantHex)
+	}
+	return nil
+}
+
+// DiagnosticsUploader tar-gzips a directory and uploads it on behalf of a
+// charge point, emitting DiagnosticsStatusNotification CALLs as it goes.
+type DiagnosticsUploader struct {
+	transport ocpp.Transport
+	client    *http.Client
+}
+
+// NewDiagnosticsUploader creates a DiagnosticsUploader that reports status over transport.
+func NewDiagnosticsUploader(transport ocpp.Transport) *DiagnosticsUploader {
+	return &DiagnosticsUploader{
+		transport: transport,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Upload archives dir as tar.gz and PUTs it to the URL in req.Location,
+// returning the uploaded archive's file name. SetDiagnosticsUploader answers
+// GetDiagnostics before Upload runs, so its GetDiagnosticsResponse carries
+// no file name.
+func (u *DiagnosticsUploader) Upload(ctx context.Context, req GetDiagnosticsRequest, dir string) (string, error) {
+	u.notify(ctx, DiagnosticsStatusUploading)
+
+	archivePath, err := u.archive(dir)
+	if err != nil {
+		u.notify(ctx, DiagnosticsStatusUploadFailed)
+		return "", fmt.Errorf("diagnostics: archive %q: %w", dir, err)
+	}
+	defer os.Remove(archivePath)
+
+	retries := req.Retries
+	if retries <= 0 {
+		retries = 1
+	}
+	interval := time.Duration(req.RetryInterval) * time.Second
+
+	var lastErr error
+	for attempt := 0; attempt < retries; attempt++ {
+		if attempt > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+		if lastErr = u.put(ctx, req.Location, archivePath); lastErr == nil {
+			break
+		}
+	}
+	if lastErr != nil {
+		u.notify(ctx, DiagnosticsStatusUploadFailed)
+		return "", fmt.Errorf("diagnostics: upload to %q: %w", req.Location, lastErr)
+	}
+
+	u.notify(ctx, DiagnosticsStatusUploaded)
+	return filepath.Base(archivePath), nil
+}
+
+// SetDiagnosticsUploader registers a CallHandler on client so inbound
+// GetDiagnostics CALLs are acknowledged immediately and handed off to
+// uploader to archive and upload dir in the background, reporting progress
+// via DiagnosticsStatusNotification as it goes.
+func SetDiagnosticsUploader(client *ocpp.WebSocketClient, uploader *DiagnosticsUploader, dir string) {
+	client.SetCallHandler("GetDiagnostics", func(payload json.RawMessage) (interface{}, error) {
+		var req GetDiagnosticsRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		go uploader.Upload(context.Background(), req, dir)
+		return &GetDiagnosticsResponse{}, nil
+	})
+}
+
+func (u *DiagnosticsUploader) notify(ctx context.Context, status DiagnosticsStatus) {
+	request := DiagnosticsStatusNotificationRequest{Status: status}
+	response := &DiagnosticsStatusNotificationResponse{}
+	u.transport.Call(ctx, "DiagnosticsStatusNotification", request, response)
+}
+
+func (u *DiagnosticsUploader) archive(dir string) (string, error) {
+	f, err := os.CreateTemp("", "diagnostics-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (u *DiagnosticsUploader) put(ctx context.Context, location, archivePath string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// UpdateFirmware sends an UpdateFirmware CALL to cpID via cs, asking the
+// charge point to download and install firmware from req.Location. It is a
+// function rather than a CentralSystem method because CentralSystem lives
+// in the core ocpp package, which this optional profile package imports
+// (not the other way around).
+func UpdateFirmware(ctx context.Context, cs *ocpp.CentralSystem, cpID string, req UpdateFirmwareRequest) (*UpdateFirmwareResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	response := &UpdateFirmwareResponse{}
+	if err := cp.Call(ctx, "UpdateFirmware", req, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetDiagnostics sends a GetDiagnostics CALL to cpID via cs, asking the
+// charge point to archive and upload its diagnostics to req.Location.
+func GetDiagnostics(ctx context.Context, cs *ocpp.CentralSystem, cpID string, req GetDiagnosticsRequest) (*GetDiagnosticsResponse, error) {
+	cp, ok := cs.ChargepointByID(cpID)
+	if !ok {
+		return nil, fmt.Errorf("ocpp: charge point %q is not connected", cpID)
+	}
+	response := &GetDiagnosticsResponse{}
+	if err := cp.Call(ctx, "GetDiagnostics", req, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ftpGet is split out so it can be swapped in tests; it performs a minimal
+// binary (TYPE I) RETR over a net/textproto-driven FTP session in passive
+// (PASV) mode, which is all firmware vendors that still ship over ftp:// tend to
+// need. It does not support FTPS/TLS.
+var ftpGet = func(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("ftp: dial %s: %w", host, err)
+	}
+	tc := textproto.NewConn(conn)
+
+	if _, _, err := tc.ReadResponse(220); err != nil {
+		tc.Close()
+		return nil, fmt.Errorf("ftp: connect to %s: %w", host, err)
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	}
+	if err := ftpCmd(tc, 331, "USER %s", user); err != nil {
+		tc.Close()
+		return nil, err
+	}
+	if err := ftpCmd(tc, 230, "PASS %s", pass); err != nil {
+		tc.Close()
+		return nil, err
+	}
+	if err := ftpCmd(tc, 200, "TYPE I"); err != nil {
+		tc.Close()
+		return nil, err
+	}
+
+	dataConn, err := ftpPassive(tc, d, ctx)
+	if err != nil {
+		tc.Close()
+		return nil, err
+	}
+
+	id, err := tc.Cmd("RETR %s", u.Path)
+	if err != nil {
+		dataConn.Close()
+		tc.Close()
+		return nil, fmt.Errorf("ftp: RETR %s: %w", u.Path, err)
+	}
+	tc.StartResponse(id)
+	_, _, err = tc.ReadCodeLine(150)
+	tc.EndResponse(id)
+	if err != nil {
+		dataConn.Close()
+		tc.Close()
+		return nil, fmt.Errorf("ftp: RETR %s: %w", u.Path, err)
+	}
+
+	return &ftpDataConn{Conn: dataConn, ctrl: tc}, nil
+}
+
+// ftpCmd sends an FTP command and requires wantCode in the reply.
+func ftpCmd(tc *textproto.Conn, wantCode int, format string, args ...interface{}) error {
+	id, err := tc.Cmd(format, args...)
+	if err != nil {
+		return fmt.Errorf("ftp: %s: %w", fmt.Sprintf(format, args...), err)
+	}
+	tc.StartResponse(id)
+	defer tc.EndResponse(id)
+	if _, _, err := tc.ReadCodeLine(wantCode); err != nil {
+		return fmt.Errorf("ftp: %s: %w", fmt.Sprintf(format, args...), err)
+	}
+	return nil
+}
+
+var pasvAddr = regexp.MustCompile(`\((\d+),(\d+),(\d+),(\d+),(\d+),(\d+)\)`)
+
+// ftpPassive issues PASV and dials the data connection it advertises.
+func ftpPassive(tc *textproto.Conn, d net.Dialer, ctx context.Context) (net.Conn, error) {
+	id, err := tc.Cmd("PASV")
+	if err != nil {
+		return nil, fmt.Errorf("ftp: PASV: %w", err)
+	}
+	tc.StartResponse(id)
+	_, line, err := tc.ReadCodeLine(227)
+	tc.EndResponse(id)
+	if err != nil {
+		return nil, fmt.Errorf("ftp: PASV: %w", err)
+	}
+
+	m := pasvAddr.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("ftp: PASV: could not parse address from %q", line)
+	}
+	parts := make([]int, 6)
+	for i, s := range m[1:] {
+		parts[i], _ = strconv.Atoi(s)
+	}
+	addr := fmt.Sprintf("%d.%d.%d.%d:%d", parts[0], parts[1], parts[2], parts[3], parts[4]*256+parts[5])
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("ftp: dial data connection %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// ftpDataConn closes the data connection and then reads the control
+// connection's final 226 Transfer complete reply, so the caller doesn't
+// leave the FTP session in an inconsistent state.
+type ftpDataConn struct {
+	net.Conn
+	ctrl *textproto.Conn
+}
+
+func (f *ftpDataConn) Close() error {
+	err := f.Conn.Close()
+	f.ctrl.ReadResponse(226)
+	f.ctrl.Close()
+	return err
+}
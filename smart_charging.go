@@ -0,0 +1,397 @@
+// Package ocpp: Smart Charging profile (OCPP 1.6).
+//
+// Adds SetChargingProfile, ClearChargingProfile, and GetCompositeSchedule,
+// along with a pure-Go CompositeSchedule helper that merges overlapping
+// profiles the same way a conformant charge point would, so both a central
+// system and a simulator can compute the effective limit without
+// duplicating the merge logic.
+
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ChargingProfilePurposeType represents the purpose of a charging profile.
+type ChargingProfilePurposeType string
+
+const (
+	ChargingProfilePurposeChargePointMaxProfile ChargingProfilePurposeType = "ChargePointMaxProfile"
+	ChargingProfilePurposeTxDefaultProfile      ChargingProfilePurposeType = "TxDefaultProfile"
+	ChargingProfilePurposeTxProfile             ChargingProfilePurposeType = "TxProfile"
+)
+
+// chargingProfilePurposePrecedence ranks purposes so that TxProfile always
+// wins over TxDefaultProfile, which always wins over ChargePointMaxProfile,
+// independent of StackLevel within the same purpose.
+var chargingProfilePurposePrecedence = map[ChargingProfilePurposeType]int{
+	ChargingProfilePurposeTxProfile:             3,
+	ChargingProfilePurposeTxDefaultProfile:      2,
+	ChargingProfilePurposeChargePointMaxProfile: 1,
+}
+
+// ChargingProfileKindType represents how a charging profile's schedule repeats.
+type ChargingProfileKindType string
+
+const (
+	ChargingProfileKindAbsolute  ChargingProfileKindType = "Absolute"
+	ChargingProfileKindRecurring ChargingProfileKindType = "Recurring"
+	ChargingProfileKindRelative  ChargingProfileKindType = "Relative"
+)
+
+// RecurrencyKindType represents the recurrence period of a Recurring profile.
+type RecurrencyKindType string
+
+const (
+	RecurrencyKindDaily  RecurrencyKindType = "Daily"
+	RecurrencyKindWeekly RecurrencyKindType = "Weekly"
+)
+
+// ChargingRateUnitType represents the unit a charging schedule's limits are expressed in.
+type ChargingRateUnitType string
+
+const (
+	ChargingRateUnitWatts ChargingRateUnitType = "W"
+	ChargingRateUnitAmps  ChargingRateUnitType = "A"
+)
+
+// ChargingSchedulePeriod represents a single period within a ChargingSchedule.
+type ChargingSchedulePeriod struct {
+	StartPeriod  int     `json:"startPeriod" validate:"gte=0"`
+	Limit        float64 `json:"limit" validate:"gte=0"`
+	NumberPhases int     `json:"numberPhases,omitempty" validate:"omitempty,oneof=1 2 3"`
+}
+
+// ChargingSchedule represents a charging schedule as defined by OCPP 1.6.
+type ChargingSchedule struct {
+	Duration               int                      `json:"duration,omitempty" validate:"omitempty,gte=0"`
+	StartSchedule          *time.Time               `json:"startSchedule,omitempty"`
+	ChargingRateUnit       ChargingRateUnitType      `json:"chargingRateUnit" validate:"required,oneof=W A"`
+	ChargingSchedulePeriod []ChargingSchedulePeriod `json:"chargingSchedulePeriod" validate:"required,min=1,dive"`
+	MinChargingRate        float64                  `json:"minChargingRate,omitempty" validate:"omitempty,gte=0"`
+}
+
+// ChargingProfile represents a charging profile as defined by OCPP 1.6.
+type ChargingProfile struct {
+	ChargingProfileId      int                        `json:"chargingProfileId" validate:"gte=0"`
+	TransactionId          int                        `json:"transactionId,omitempty" validate:"omitempty,gte=0"`
+	StackLevel             int                        `json:"stackLevel" validate:"gte=0"`
+	ChargingProfilePurpose ChargingProfilePurposeType `json:"chargingProfilePurpose" validate:"required"`
+	ChargingProfileKind    ChargingProfileKindType    `json:"chargingProfileKind" validate:"required"`
+	RecurrencyKind         RecurrencyKindType         `json:"recurrencyKind,omitempty"`
+	ValidFrom              *time.Time                 `json:"validFrom,omitempty"`
+	ValidTo                *time.Time                 `json:"validTo,omitempty"`
+	ChargingSchedule       ChargingSchedule           `json:"chargingSchedule" validate:"required"`
+}
+
+// SetChargingProfileStatus represents the response status for SetChargingProfile.
+type SetChargingProfileStatus string
+
+const (
+	SetChargingProfileStatusAccepted    SetChargingProfileStatus = "Accepted"
+	SetChargingProfileStatusRejected    SetChargingProfileStatus = "Rejected"
+	SetChargingProfileStatusNotSupported SetChargingProfileStatus = "NotSupported"
+)
+
+// SetChargingProfileRequest represents a SetChargingProfile request.
+type SetChargingProfileRequest struct {
+	ConnectorId     int             `json:"connectorId" validate:"gte=0"`
+	ChargingProfile ChargingProfile `json:"csChargingProfiles" validate:"required"`
+}
+
+// SetChargingProfileResponse represents a SetChargingProfile response.
+type SetChargingProfileResponse struct {
+	Status SetChargingProfileStatus `json:"status"`
+}
+
+// ClearChargingProfileStatus represents the response status for ClearChargingProfile.
+type ClearChargingProfileStatus string
+
+const (
+	ClearChargingProfileStatusAccepted ClearChargingProfileStatus = "Accepted"
+	ClearChargingProfileStatusUnknown  ClearChargingProfileStatus = "Unknown"
+)
+
+// ClearChargingProfileRequest represents a ClearChargingProfile request. All
+// fields are optional filters; a zero value means "don't filter on this".
+type ClearChargingProfileRequest struct {
+	ChargingProfileId      int                        `json:"id,omitempty" validate:"omitempty,gte=0"`
+	ConnectorId            int                        `json:"connectorId,omitempty" validate:"omitempty,gte=0"`
+	ChargingProfilePurpose ChargingProfilePurposeType `json:"chargingProfilePurpose,omitempty"`
+	StackLevel             int                        `json:"stackLevel,omitempty" validate:"omitempty,gte=0"`
+}
+
+// ClearChargingProfileResponse represents a ClearChargingProfile response.
+type ClearChargingProfileResponse struct {
+	Status ClearChargingProfileStatus `json:"status"`
+}
+
+// GetCompositeScheduleStatus represents the response status for GetCompositeSchedule.
+type GetCompositeScheduleStatus string
+
+const (
+	GetCompositeScheduleStatusAccepted GetCompositeScheduleStatus = "Accepted"
+	GetCompositeScheduleStatusRejected GetCompositeScheduleStatus = "Rejected"
+)
+
+// GetCompositeScheduleRequest represents a GetCompositeSchedule request.
+type GetCompositeScheduleRequest struct {
+	ConnectorId      int                  `json:"connectorId" validate:"gte=0"`
+	Duration         int                  `json:"duration" validate:"required,gte=0"`
+	ChargingRateUnit ChargingRateUnitType `json:"chargingRateUnit,omitempty" validate:"omitempty,oneof=W A"`
+}
+
+// GetCompositeScheduleResponse represents a GetCompositeSchedule response.
+type GetCompositeScheduleResponse struct {
+	Status           GetCompositeScheduleStatus `json:"status"`
+	ConnectorId      int                        `json:"connectorId,omitempty"`
+	ScheduleStart    *time.Time                 `json:"scheduleStart,omitempty"`
+	ChargingSchedule *ChargingSchedule          `json:"chargingSchedule,omitempty"`
+}
+
+// SetChargingProfile sends a SetChargingProfile CALL to the charge point.
+func (c *WebSocketClient) SetChargingProfile(ctx context.Context, connectorID int, profile ChargingProfile) (*SetChargingProfileResponse, error) {
+	request := SetChargingProfileRequest{ConnectorId: connectorID, ChargingProfile: profile}
+	response := &SetChargingProfileResponse{}
+	if err := c.Call(ctx, "SetChargingProfile", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ClearChargingProfile sends a ClearChargingProfile CALL to the charge point.
+func (c *WebSocketClient) ClearChargingProfile(ctx context.Context, filter ClearChargingProfileRequest) (*ClearChargingProfileResponse, error) {
+	response := &ClearChargingProfileResponse{}
+	if err := c.Call(ctx, "ClearChargingProfile", filter, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetCompositeSchedule sends a GetCompositeSchedule CALL to the charge point.
+func (c *WebSocketClient) GetCompositeSchedule(ctx context.Context, request GetCompositeScheduleRequest) (*GetCompositeScheduleResponse, error) {
+	response := &GetCompositeScheduleResponse{}
+	if err := c.Call(ctx, "GetCompositeSchedule", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// isActiveAt reports whether profile applies at instant t according to its
+// ValidFrom/ValidTo. The schedule itself, including a Recurring profile's
+// period, is evaluated by limitAt.
+func isActiveAt(profile ChargingProfile, t time.Time) bool {
+	if profile.ValidFrom != nil && t.Before(*profile.ValidFrom) {
+		return false
+	}
+	if profile.ValidTo != nil && !t.Before(*profile.ValidTo) {
+		return false
+	}
+	return true
+}
+
+// recurringWindowStart returns the start of the recurrence window (day or
+// week) containing t, per profile.RecurrencyKind.
+func recurringWindowStart(profile ChargingProfile, t time.Time) time.Time {
+	switch profile.RecurrencyKind {
+	case RecurrencyKindWeekly:
+		weekday := int(t.Weekday())
+		return time.Date(t.Year(), t.Month(), t.Day()-weekday, 0, 0, 0, 0, t.Location())
+	default: // Daily
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// limitAt returns the limit in effect for profile at instant t, and whether
+// the profile has any period covering t at all.
+func limitAt(profile ChargingProfile, t time.Time) (ChargingSchedulePeriod, bool) {
+	sched := profile.ChargingSchedule
+
+	var elapsed int
+	switch profile.ChargingProfileKind {
+	case ChargingProfileKindRecurring:
+		start := recurringWindowStart(profile, t)
+		elapsed = int(t.Sub(start).Seconds())
+	case ChargingProfileKindRelative:
+		if sched.StartSchedule == nil {
+			return ChargingSchedulePeriod{}, false
+		}
+		elapsed = int(t.Sub(*sched.StartSchedule).Seconds())
+	default: // Absolute
+		if sched.StartSchedule == nil {
+			return ChargingSchedulePeriod{}, false
+		}
+		elapsed = int(t.Sub(*sched.StartSchedule).Seconds())
+	}
+
+	if elapsed < 0 {
+		return ChargingSchedulePeriod{}, false
+	}
+	if sched.Duration > 0 && elapsed >= sched.Duration {
+		return ChargingSchedulePeriod{}, false
+	}
+
+	periods := append([]ChargingSchedulePeriod(nil), sched.ChargingSchedulePeriod...)
+	sort.Slice(periods, func(i, j int) bool { return periods[i].StartPeriod < periods[j].StartPeriod })
+
+	var active ChargingSchedulePeriod
+	found := false
+	for _, p := range periods {
+		if p.StartPeriod <= elapsed {
+			active = p
+			found = true
+		}
+	}
+	return active, found
+}
+
+// ChargingProfileAssignment pairs a ChargingProfile with the connector it
+// was set on via SetChargingProfileRequest.ConnectorId. ChargingProfile
+// itself carries no connector field per the OCPP 1.6 schema, so callers
+// that track multiple connectors' profiles need this wrapper to tell
+// CompositeSchedule which profiles actually apply to the connector it's
+// computing for. ConnectorId 0 means "all connectors" (ChargePointMaxProfile
+// is typically set this way) and is never filtered out.
+type ChargingProfileAssignment struct {
+	ConnectorId int
+	Profile     ChargingProfile
+}
+
+// CompositeSchedule merges the profiles assigned to connectorID (plus any
+// assigned to connector 0, which applies charge-point-wide) into the single
+// effective schedule over [from, to), the way a conformant charge point
+// would: ChargingProfilePurpose decides precedence first
+// (TxProfile > TxDefaultProfile > ChargePointMaxProfile), StackLevel breaks
+// ties within the same purpose (higher wins), Recurring profiles are
+// evaluated against the daily/weekly window containing each instant, and
+// the result is the minimal set of periods needed to represent every limit
+// change in the window. Where no profile is in effect at a boundary, no
+// period starts there, so the preceding period's limit runs on.
+func CompositeSchedule(assignments []ChargingProfileAssignment, from, to time.Time, connectorID int) (ChargingSchedule, error) {
+	if !to.After(from) {
+		return ChargingSchedule{}, fmt.Errorf("ocpp: composite schedule window must be non-empty")
+	}
+
+	var profiles []ChargingProfile
+	for _, a := range assignments {
+		if a.ConnectorId == 0 || a.ConnectorId == connectorID {
+			profiles = append(profiles, a.Profile)
+		}
+	}
+
+	unit := ChargingRateUnitWatts
+	for _, p := range profiles {
+		if p.ChargingSchedule.ChargingRateUnit != "" {
+			unit = p.ChargingSchedule.ChargingRateUnit
+			break
+		}
+	}
+
+	// Candidate boundaries: window start, each profile's ValidFrom/ValidTo,
+	// and every period's StartPeriod offset plus the schedule's Duration end,
+	// reprojected into [from, to) for every profile kind.
+	boundaries := map[time.Time]struct{}{from: {}}
+	for _, profile := range profiles {
+		for _, edge := range []*time.Time{profile.ValidFrom, profile.ValidTo} {
+			if edge != nil && !edge.Before(from) && edge.Before(to) {
+				boundaries[*edge] = struct{}{}
+			}
+		}
+		offsets := make([]int, 0, len(profile.ChargingSchedule.ChargingSchedulePeriod)+1)
+		for _, p := range profile.ChargingSchedule.ChargingSchedulePeriod {
+			offsets = append(offsets, p.StartPeriod)
+		}
+		if profile.ChargingSchedule.Duration > 0 {
+			offsets = append(offsets, profile.ChargingSchedule.Duration)
+		}
+		for _, startPeriod := range offsets {
+			offset := time.Duration(startPeriod) * time.Second
+			switch profile.ChargingProfileKind {
+			case ChargingProfileKindRecurring:
+				cursor := recurringWindowStart(profile, from)
+				for cursor.Before(to) {
+					candidate := cursor.Add(offset)
+					if !candidate.Before(from) && candidate.Before(to) {
+						boundaries[candidate] = struct{}{}
+					}
+					if profile.RecurrencyKind == RecurrencyKindWeekly {
+						cursor = cursor.AddDate(0, 0, 7)
+					} else {
+						cursor = cursor.AddDate(0, 0, 1)
+					}
+				}
+			default:
+				if profile.ChargingSchedule.StartSchedule == nil {
+					continue
+				}
+				candidate := profile.ChargingSchedule.StartSchedule.Add(offset)
+				if !candidate.Before(from) && candidate.Before(to) {
+					boundaries[candidate] = struct{}{}
+				}
+			}
+		}
+	}
+
+	sortedBoundaries := make([]time.Time, 0, len(boundaries))
+	for t := range boundaries {
+		sortedBoundaries = append(sortedBoundaries, t)
+	}
+	sort.Slice(sortedBoundaries, func(i, j int) bool { return sortedBoundaries[i].Before(sortedBoundaries[j]) })
+
+	result := ChargingSchedule{
+		Duration:         int(to.Sub(from).Seconds()),
+		StartSchedule:    &from,
+		ChargingRateUnit: unit,
+	}
+
+	var lastLimit float64 = -1
+	for _, t := range sortedBoundaries {
+		limit, ok := effectiveLimit(profiles, t)
+		if !ok {
+			continue
+		}
+		if limit == lastLimit {
+			continue
+		}
+		lastLimit = limit
+		result.ChargingSchedulePeriod = append(result.ChargingSchedulePeriod, ChargingSchedulePeriod{
+			StartPeriod: int(t.Sub(from).Seconds()),
+			Limit:       limit,
+		})
+	}
+
+	return result, nil
+}
+
+// effectiveLimit picks the winning profile at instant t by purpose
+// precedence then StackLevel, and returns its limit.
+func effectiveLimit(profiles []ChargingProfile, t time.Time) (float64, bool) {
+	var (
+		best       ChargingSchedulePeriod
+		bestFound  bool
+		bestRank   = -1
+		bestLevel  = -1
+	)
+
+	for _, profile := range profiles {
+		if !isActiveAt(profile, t) {
+			continue
+		}
+		period, ok := limitAt(profile, t)
+		if !ok {
+			continue
+		}
+		rank := chargingProfilePurposePrecedence[profile.ChargingProfilePurpose]
+		if rank > bestRank || (rank == bestRank && profile.StackLevel > bestLevel) {
+			best = period
+			bestFound = true
+			bestRank = rank
+			bestLevel = profile.StackLevel
+		}
+	}
+
+	return best.Limit, bestFound
+}
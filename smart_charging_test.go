@@ -0,0 +1,98 @@
+package ocpp
+
+import (
+	"testing"
+	"time"
+)
+
+func schedule(unit ChargingRateUnitType, limit float64) ChargingSchedule {
+	return ChargingSchedule{
+		ChargingRateUnit:       unit,
+		ChargingSchedulePeriod: []ChargingSchedulePeriod{{StartPeriod: 0, Limit: limit}},
+	}
+}
+
+func TestCompositeSchedulePurposePrecedence(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	assignments := []ChargingProfileAssignment{
+		{ConnectorId: 1, Profile: ChargingProfile{
+			ChargingProfilePurpose: ChargingProfilePurposeChargePointMaxProfile,
+			ChargingProfileKind:    ChargingProfileKindAbsolute,
+			ChargingSchedule:       withStart(schedule(ChargingRateUnitWatts, 32000), from),
+		}},
+		{ConnectorId: 1, Profile: ChargingProfile{
+			ChargingProfilePurpose: ChargingProfilePurposeTxProfile,
+			ChargingProfileKind:    ChargingProfileKindAbsolute,
+			ChargingSchedule:       withStart(schedule(ChargingRateUnitWatts, 11000), from),
+		}},
+	}
+
+	result, err := CompositeSchedule(assignments, from, to, 1)
+	if err != nil {
+		t.Fatalf("CompositeSchedule: %v", err)
+	}
+	if len(result.ChargingSchedulePeriod) != 1 || result.ChargingSchedulePeriod[0].Limit != 11000 {
+		t.Fatalf("expected TxProfile (11000W) to win over ChargePointMaxProfile, got %+v", result.ChargingSchedulePeriod)
+	}
+}
+
+func TestCompositeScheduleStackLevelTiebreak(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	assignments := []ChargingProfileAssignment{
+		{ConnectorId: 1, Profile: ChargingProfile{
+			ChargingProfilePurpose: ChargingProfilePurposeTxDefaultProfile,
+			ChargingProfileKind:    ChargingProfileKindAbsolute,
+			StackLevel:             0,
+			ChargingSchedule:       withStart(schedule(ChargingRateUnitWatts, 16000), from),
+		}},
+		{ConnectorId: 1, Profile: ChargingProfile{
+			ChargingProfilePurpose: ChargingProfilePurposeTxDefaultProfile,
+			ChargingProfileKind:    ChargingProfileKindAbsolute,
+			StackLevel:             1,
+			ChargingSchedule:       withStart(schedule(ChargingRateUnitWatts, 7000), from),
+		}},
+	}
+
+	result, err := CompositeSchedule(assignments, from, to, 1)
+	if err != nil {
+		t.Fatalf("CompositeSchedule: %v", err)
+	}
+	if len(result.ChargingSchedulePeriod) != 1 || result.ChargingSchedulePeriod[0].Limit != 7000 {
+		t.Fatalf("expected the higher StackLevel (7000W) to win, got %+v", result.ChargingSchedulePeriod)
+	}
+}
+
+func TestCompositeScheduleFiltersByConnector(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	assignments := []ChargingProfileAssignment{
+		{ConnectorId: 2, Profile: ChargingProfile{
+			ChargingProfilePurpose: ChargingProfilePurposeTxProfile,
+			ChargingProfileKind:    ChargingProfileKindAbsolute,
+			ChargingSchedule:       withStart(schedule(ChargingRateUnitWatts, 5000), from),
+		}},
+		{ConnectorId: 0, Profile: ChargingProfile{
+			ChargingProfilePurpose: ChargingProfilePurposeChargePointMaxProfile,
+			ChargingProfileKind:    ChargingProfileKindAbsolute,
+			ChargingSchedule:       withStart(schedule(ChargingRateUnitWatts, 32000), from),
+		}},
+	}
+
+	result, err := CompositeSchedule(assignments, from, to, 1)
+	if err != nil {
+		t.Fatalf("CompositeSchedule: %v", err)
+	}
+	if len(result.ChargingSchedulePeriod) != 1 || result.ChargingSchedulePeriod[0].Limit != 32000 {
+		t.Fatalf("expected connector 2's TxProfile to be filtered out and the connector-0 ChargePointMaxProfile (32000W) to apply, got %+v", result.ChargingSchedulePeriod)
+	}
+}
+
+func withStart(s ChargingSchedule, start time.Time) ChargingSchedule {
+	s.StartSchedule = &start
+	return s
+}
@@ -0,0 +1,161 @@
+// Package ocpp: SQLite-backed AuthorizationStore.
+//
+// SQLiteAuthStore persists the local authorization list across restarts,
+// for charge points that need the cache to survive a power cycle rather
+// than starting cold with MemoryAuthStore.
+
+package ocpp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteAuthStore is an AuthorizationStore backed by a SQLite database file.
+type SQLiteAuthStore struct {
+	db *sql.DB
+
+	// versionMu serializes Version/ReplaceAll/Update so the read-check-write
+	// sequence in Update is atomic across concurrent differential updates;
+	// without it two callers can both read the same current version and
+	// both pass the version == current+1 check, corrupting the monotonic
+	// version invariant AuthorizationStore requires.
+	versionMu sync.Mutex
+}
+
+// NewSQLiteAuthStore opens (creating if necessary) a SQLite database at
+// path and prepares the schema used to persist the local authorization list.
+func NewSQLiteAuthStore(path string) (*SQLiteAuthStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("ocpp: open auth store %q: %w", path, err)
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS auth_entries (
+		id_tag TEXT PRIMARY KEY,
+		id_tag_info TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS auth_meta (
+		key TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ocpp: init auth store schema: %w", err)
+	}
+
+	return &SQLiteAuthStore{db: db}, nil
+}
+
+// Close releases the underlying database handle.
+func (s *SQLiteAuthStore) Close() error {
+	return s.db.Close()
+}
+
+// Get implements AuthorizationStore.
+func (s *SQLiteAuthStore) Get(idTag string) (IdTagInfo, bool) {
+	var raw string
+	err := s.db.QueryRow(`SELECT id_tag_info FROM auth_entries WHERE id_tag = ?`, idTag).Scan(&raw)
+	if err != nil {
+		return IdTagInfo{}, false
+	}
+	var info IdTagInfo
+	if json.Unmarshal([]byte(raw), &info) != nil {
+		return IdTagInfo{}, false
+	}
+	return info, true
+}
+
+// Put implements AuthorizationStore.
+func (s *SQLiteAuthStore) Put(idTag string, info IdTagInfo) {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	s.db.Exec(`INSERT INTO auth_entries (id_tag, id_tag_info) VALUES (?, ?)
+		ON CONFLICT(id_tag) DO UPDATE SET id_tag_info = excluded.id_tag_info`, idTag, string(raw))
+}
+
+// Version implements AuthorizationStore.
+func (s *SQLiteAuthStore) Version() int {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	return s.version()
+}
+
+func (s *SQLiteAuthStore) version() int {
+	var version int
+	if err := s.db.QueryRow(`SELECT value FROM auth_meta WHERE key = 'version'`).Scan(&version); err != nil {
+		return 0
+	}
+	return version
+}
+
+// ReplaceAll implements AuthorizationStore.
+func (s *SQLiteAuthStore) ReplaceAll(version int, entries []AuthListEntry) error {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ocpp: begin replace: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM auth_entries`); err != nil {
+		return fmt.Errorf("ocpp: clear auth entries: %w", err)
+	}
+	for _, e := range entries {
+		raw, err := json.Marshal(e.IdTagInfo)
+		if err != nil {
+			return fmt.Errorf("ocpp: marshal idTagInfo for %q: %w", e.IdTag, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO auth_entries (id_tag, id_tag_info) VALUES (?, ?)`, e.IdTag, string(raw)); err != nil {
+			return fmt.Errorf("ocpp: insert auth entry %q: %w", e.IdTag, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO auth_meta (key, value) VALUES ('version', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, version); err != nil {
+		return fmt.Errorf("ocpp: persist version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Update implements AuthorizationStore, rejecting any update whose version
+// is not exactly current+1.
+func (s *SQLiteAuthStore) Update(version int, entries []AuthListEntry) error {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+
+	current := s.version()
+	if version != current+1 {
+		return fmt.Errorf("ocpp: differential update version %d is not current version %d + 1", version, current)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ocpp: begin update: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, e := range entries {
+		raw, err := json.Marshal(e.IdTagInfo)
+		if err != nil {
+			return fmt.Errorf("ocpp: marshal idTagInfo for %q: %w", e.IdTag, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO auth_entries (id_tag, id_tag_info) VALUES (?, ?)
+			ON CONFLICT(id_tag) DO UPDATE SET id_tag_info = excluded.id_tag_info`, e.IdTag, string(raw)); err != nil {
+			return fmt.Errorf("ocpp: upsert auth entry %q: %w", e.IdTag, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO auth_meta (key, value) VALUES ('version', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, version); err != nil {
+		return fmt.Errorf("ocpp: persist version: %w", err)
+	}
+	return tx.Commit()
+}
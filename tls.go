@@ -0,0 +1,81 @@
+// Package ocpp: TLS/mTLS support.
+//
+// Adds a TLSConfig option to Client and WebSocketClient so a charge point
+// can present a client certificate and validate the CSMS it connects to,
+// the prerequisite for the Security Extensions message set in
+// certificates.go.
+
+package ocpp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// WithClientCertificate loads a client certificate/key pair and returns a
+// TLSConfigOption that presents it during the TLS handshake, for mutual TLS.
+func WithClientCertificate(certFile, keyFile string) TLSConfigOption {
+	return func(cfg *tls.Config) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("ocpp: load client certificate: %w", err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+		return nil
+	}
+}
+
+// WithServerCA loads a PEM-encoded CA bundle and returns a TLSConfigOption
+// that validates the CSMS's certificate against it, instead of the system
+// trust store.
+func WithServerCA(caFile string) TLSConfigOption {
+	return func(cfg *tls.Config) error {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("ocpp: read server CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ocpp: no certificates found in %q", caFile)
+		}
+		cfg.RootCAs = pool
+		return nil
+	}
+}
+
+// TLSConfigOption mutates a tls.Config being built up by NewTLSConfig.
+type TLSConfigOption func(*tls.Config) error
+
+// NewTLSConfig builds a *tls.Config from the given options, applied in order.
+func NewTLSConfig(opts ...TLSConfigOption) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// SetTLSConfig installs tlsConfig on the HTTP client used for legacy
+// XML/SOAP requests.
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	httpClient := *c.client
+	httpClient.Transport = transport
+	c.client = &httpClient
+}
+
+// SetTLSConfig installs tlsConfig on the dialer used to connect to the
+// CSMS. It takes effect on the next dial: the first Connect, or the
+// automatic reconnect after the connection drops.
+func (c *WebSocketClient) SetTLSConfig(tlsConfig *tls.Config) {
+	dialer := *c.dialer
+	dialer.TLSClientConfig = tlsConfig
+	c.dialer = &dialer
+}
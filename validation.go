@@ -0,0 +1,88 @@
+// Package ocpp: message validation.
+//
+// OCPP 1.6's JSON schema imposes length/format constraints on many fields
+// (chargeBoxIdentity <= 20 chars, idTag <= 20 chars, vendorId <= 255, ...)
+// that the Go structs in this package previously left unenforced. Validator
+// lets a request be checked against those constraints before it goes over
+// the wire, and a response be checked after it comes back.
+
+package ocpp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator validates a request before it is sent, or a response after it
+// is decoded. Implementations should treat a nil value as valid.
+type Validator interface {
+	Validate(v interface{}) error
+}
+
+// ValidationError wraps a failed validation, identifying which struct and
+// rule failed so callers can log or report it without parsing the
+// underlying validator's error string.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("ocpp: validation failed: %s", e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// defaultValidator validates struct tags using go-playground/validator/v10,
+// the same tag set used in every request/response struct in this package.
+type defaultValidator struct {
+	validate *validator.Validate
+}
+
+// NewDefaultValidator returns the Validator used by Client and
+// WebSocketClient when none is configured via SetValidator.
+func NewDefaultValidator() Validator {
+	v := validator.New()
+	v.RegisterValidation("iso8601", validateISO8601)
+	return &defaultValidator{validate: v}
+}
+
+// validateISO8601 checks that a field holds an ISO-8601/RFC3339 timestamp,
+// the format OCPP 1.6 requires for every dateTime field.
+func validateISO8601(fl validator.FieldLevel) bool {
+	s := fl.Field().String()
+	if s == "" {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+func (d *defaultValidator) Validate(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if err := d.validate.Struct(v); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			// v isn't a struct or is a nil pointer; nothing to validate.
+			return nil
+		}
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
+
+// noopValidator is returned by WithoutValidation.
+type noopValidator struct{}
+
+func (noopValidator) Validate(v interface{}) error { return nil }
+
+// WithoutValidation returns a Validator that accepts everything, for
+// interoperating with charge points or central systems that don't comply
+// with the OCPP 1.6 JSON schema. Use it via SetValidator.
+func WithoutValidation() Validator {
+	return noopValidator{}
+}
@@ -0,0 +1,540 @@
+// Package ocpp: OCPP-J (JSON-over-WebSocket) transport.
+//
+// OCPP 1.6 deployments overwhelmingly speak OCPP-J rather than the SOAP/XML
+// binding implemented by Client. This file adds a WebSocketClient that dials
+// a charge point endpoint, negotiates the "ocpp1.6" subprotocol, and frames
+// requests/responses per the OCPP-J message format:
+//
+//	[2, "<uniqueId>", "<action>", {payload}]   CALL
+//	[3, "<uniqueId>", {payload}]                CALLRESULT
+//	[4, "<uniqueId>", "<errorCode>", "<errorDescription>", {details}]  CALLERROR
+
+package ocpp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// Transport abstracts the wire protocol used to exchange OCPP messages with
+// a charge point, so callers can share request/response types across the
+// legacy XML/HTTP binding (Client) and the OCPP-J binding (WebSocketClient).
+type Transport interface {
+	// Call sends action with request and decodes the result into response.
+	Call(ctx context.Context, action string, request interface{}, response interface{}) error
+}
+
+const (
+	messageTypeCall       = 2
+	messageTypeCallResult = 3
+	messageTypeCallError  = 4
+
+	ocppSubprotocol = "ocpp1.6"
+
+	// DefaultCallTimeout is used when no per-call timeout is supplied via context.
+	DefaultCallTimeout = 30 * time.Second
+)
+
+// OCPPError represents a CALLERROR response received from the remote party.
+type OCPPError struct {
+	Code        ErrorCode
+	Description string
+	Details     json.RawMessage
+}
+
+func (e *OCPPError) Error() string {
+	return fmt.Sprintf("ocpp: %s: %s", e.Code, e.Description)
+}
+
+// pendingCall tracks an in-flight CALL awaiting its CALLRESULT/CALLERROR.
+type pendingCall struct {
+	response interface{}
+	done     chan error
+}
+
+// WebSocketClient is an OCPP-J client for a single charge point identity.
+// It dials the CSMS endpoint, demultiplexes incoming frames back to the
+// caller that sent the matching UniqueId, and reconnects automatically if
+// the connection drops.
+type WebSocketClient struct {
+	endpoint          string
+	chargeBoxIdentity string
+	logger            *zap.Logger
+	dialer            *websocket.Dialer
+
+	callTimeout   time.Duration
+	authMu        sync.Mutex
+	authStore     AuthorizationStore
+	validator     Validator
+	pendingCSRKey crypto.Signer
+
+	mu           sync.Mutex
+	conn         *websocket.Conn
+	pending      map[string]*pendingCall
+	callHandlers map[string]CallHandlerFunc
+	writeMu      sync.Mutex
+
+	closeCh chan struct{}
+	closed  bool
+}
+
+// NewWebSocketClient creates a WebSocketClient for the given base endpoint
+// (e.g. "wss://csms.example.com/ocpp") and charge box identity. The
+// identity is appended as the final URL segment, as required by the OCPP-J
+// spec. Dial does not happen until Connect is called.
+func NewWebSocketClient(endpoint, chargeBoxIdentity string, logger *zap.Logger) *WebSocketClient {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &WebSocketClient{
+		endpoint:          endpoint,
+		chargeBoxIdentity: chargeBoxIdentity,
+		logger:            logger,
+		dialer:            websocket.DefaultDialer,
+		callTimeout:       DefaultCallTimeout,
+		validator:         NewDefaultValidator(),
+		pending:           make(map[string]*pendingCall),
+		closeCh:           make(chan struct{}),
+	}
+}
+
+// SetValidator overrides the Validator used to check outbound requests and
+// inbound responses. Pass WithoutValidation() to disable validation
+// entirely for stations that don't comply with the OCPP 1.6 JSON schema.
+func (c *WebSocketClient) SetValidator(v Validator) {
+	c.validator = v
+}
+
+// SetDialer allows overriding the websocket dialer, e.g. to supply TLS config.
+func (c *WebSocketClient) SetDialer(d *websocket.Dialer) {
+	c.dialer = d
+}
+
+// SetCallTimeout overrides the default per-call timeout applied when ctx
+// carries no deadline.
+func (c *WebSocketClient) SetCallTimeout(d time.Duration) {
+	c.callTimeout = d
+}
+
+// CallHandlerFunc handles a single inbound CALL action sent by the central
+// system (e.g. RemoteStartTransaction, Reset, CertificateSigned), decoding
+// payload into whatever request type the action expects and returning the
+// response to answer with.
+type CallHandlerFunc func(payload json.RawMessage) (response interface{}, err error)
+
+// SetCallHandler registers handler for inbound CALLs named action. If no
+// handler is registered for an action the central system sends, dispatch
+// replies immediately with a CALLERROR NotImplemented instead of leaving
+// the central system waiting on the call timeout.
+func (c *WebSocketClient) SetCallHandler(action string, handler CallHandlerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.callHandlers == nil {
+		c.callHandlers = make(map[string]CallHandlerFunc)
+	}
+	c.callHandlers[action] = handler
+}
+
+// Connect dials the charge point endpoint, negotiating the ocpp1.6
+// subprotocol, and starts the background reader. If the connection later
+// drops, Connect's internal reconnect loop re-dials with exponential
+// back-off until Close is called.
+func (c *WebSocketClient) Connect(ctx context.Context) error {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return fmt.Errorf("ocpp: invalid endpoint: %w", err)
+	}
+	u.Path = fmt.Sprintf("%s/%s", u.Path, url.PathEscape(c.chargeBoxIdentity))
+
+	base := c.dialer
+	if base == nil {
+		base = websocket.DefaultDialer
+	}
+	dialer := *base
+	dialer.Subprotocols = []string{ocppSubprotocol}
+
+	conn, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("ocpp: dial %s: %w", u.String(), err)
+	}
+	if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return fmt.Errorf("ocpp: unexpected handshake status %s", resp.Status)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	go c.readLoop()
+	return nil
+}
+
+// Close shuts down the connection and stops reconnect attempts.
+func (c *WebSocketClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	close(c.closeCh)
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// readLoop demultiplexes incoming frames to the pending call they answer,
+// and reconnects with exponential back-off if the connection drops.
+func (c *WebSocketClient) readLoop() {
+	backoff := time.Second
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn == nil {
+			return
+		}
+
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-c.closeCh:
+				return
+			default:
+			}
+			c.logger.Warn("ocpp: read error, reconnecting", zap.Error(err))
+			c.failAllPending(fmt.Errorf("ocpp: connection lost: %w", err))
+
+			time.Sleep(backoff)
+			backoff = time.Duration(math.Min(float64(backoff*2), float64(30*time.Second)))
+			for {
+				select {
+				case <-c.closeCh:
+					return
+				default:
+				}
+				if rerr := c.Connect(context.Background()); rerr != nil {
+					c.logger.Warn("ocpp: reconnect failed", zap.Error(rerr))
+					time.Sleep(backoff)
+					backoff = time.Duration(math.Min(float64(backoff*2), float64(30*time.Second)))
+					continue
+				}
+				break
+			}
+			// Connect started a fresh readLoop goroutine that now owns the
+			// new connection; this goroutine's job is done.
+			return
+		}
+
+		c.dispatch(raw)
+	}
+}
+
+func (c *WebSocketClient) dispatch(raw []byte) {
+	var frame []json.RawMessage
+	if err := json.Unmarshal(raw, &frame); err != nil || len(frame) < 3 {
+		c.logger.Warn("ocpp: malformed frame", zap.ByteString("raw", raw))
+		return
+	}
+
+	var messageType int
+	if err := json.Unmarshal(frame[0], &messageType); err != nil {
+		c.logger.Warn("ocpp: frame missing message type", zap.ByteString("raw", raw))
+		return
+	}
+
+	var uniqueID string
+	if err := json.Unmarshal(frame[1], &uniqueID); err != nil {
+		c.logger.Warn("ocpp: frame missing unique id", zap.ByteString("raw", raw))
+		return
+	}
+
+	if messageType == messageTypeCall {
+		if len(frame) < 4 {
+			c.logger.Warn("ocpp: malformed CALL", zap.String("uniqueId", uniqueID))
+			return
+		}
+		var action string
+		json.Unmarshal(frame[2], &action)
+		c.handleInboundCall(uniqueID, action, frame[3])
+		return
+	}
+
+	c.mu.Lock()
+	call, ok := c.pending[uniqueID]
+	if ok {
+		delete(c.pending, uniqueID)
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.logger.Warn("ocpp: no pending call for unique id", zap.String("uniqueId", uniqueID))
+		return
+	}
+
+	switch messageType {
+	case messageTypeCallResult:
+		if err := json.Unmarshal(frame[2], call.response); err != nil {
+			call.done <- fmt.Errorf("ocpp: decode CALLRESULT: %w", err)
+			return
+		}
+		call.done <- nil
+	case messageTypeCallError:
+		if len(frame) < 4 {
+			call.done <- fmt.Errorf("ocpp: malformed CALLERROR")
+			return
+		}
+		ocppErr := &OCPPError{}
+		json.Unmarshal(frame[2], &ocppErr.Code)
+		json.Unmarshal(frame[3], &ocppErr.Description)
+		if len(frame) > 4 {
+			ocppErr.Details = frame[4]
+		}
+		call.done <- ocppErr
+	default:
+		call.done <- fmt.Errorf("ocpp: unexpected message type %d", messageType)
+	}
+}
+
+// handleInboundCall dispatches a CALL received from the central system to
+// a registered CallHandlerFunc and always answers with a CALLRESULT or a
+// CALLERROR, mirroring CentralSystem.handleCall on the other side of the
+// connection.
+func (c *WebSocketClient) handleInboundCall(uniqueID, action string, payload json.RawMessage) {
+	c.mu.Lock()
+	handler, ok := c.callHandlers[action]
+	c.mu.Unlock()
+	if !ok {
+		c.sendCallError(uniqueID, ErrorCodeNotImplemented, fmt.Sprintf("action %q is not supported", action))
+		return
+	}
+
+	response, err := handler(payload)
+	if err != nil {
+		c.sendCallError(uniqueID, ErrorCodeInternalError, err.Error())
+		return
+	}
+	c.sendCallResult(uniqueID, response)
+}
+
+func (c *WebSocketClient) sendCallResult(uniqueID string, response interface{}) {
+	frame := []interface{}{messageTypeCallResult, uniqueID, response}
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		c.logger.Error("ocpp: marshal CALLRESULT", zap.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		c.logger.Warn("ocpp: write CALLRESULT", zap.Error(err))
+	}
+}
+
+func (c *WebSocketClient) sendCallError(uniqueID string, code ErrorCode, description string) {
+	frame := []interface{}{messageTypeCallError, uniqueID, code, description, json.RawMessage("{}")}
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		c.logger.Error("ocpp: marshal CALLERROR", zap.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		c.logger.Warn("ocpp: write CALLERROR", zap.Error(err))
+	}
+}
+
+func (c *WebSocketClient) failAllPending(err error) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*pendingCall)
+	c.mu.Unlock()
+
+	for _, call := range pending {
+		call.done <- err
+	}
+}
+
+// Call implements Transport by sending a CALL frame and waiting for the
+// matching CALLRESULT/CALLERROR, honoring ctx's deadline or the client's
+// default call timeout.
+func (c *WebSocketClient) Call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	if err := c.validator.Validate(request); err != nil {
+		return err
+	}
+
+	uniqueID, err := newUniqueID()
+	if err != nil {
+		return fmt.Errorf("ocpp: generate unique id: %w", err)
+	}
+
+	frame := []interface{}{messageTypeCall, uniqueID, action, request}
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("ocpp: marshal CALL: %w", err)
+	}
+
+	call := &pendingCall{response: response, done: make(chan error, 1)}
+	c.mu.Lock()
+	conn := c.conn
+	c.pending[uniqueID] = call
+	c.mu.Unlock()
+
+	if conn == nil {
+		c.mu.Lock()
+		delete(c.pending, uniqueID)
+		c.mu.Unlock()
+		return fmt.Errorf("ocpp: not connected")
+	}
+
+	c.writeMu.Lock()
+	err = conn.WriteMessage(websocket.TextMessage, payload)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, uniqueID)
+		c.mu.Unlock()
+		return fmt.Errorf("ocpp: write CALL: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.callTimeout)
+		defer cancel()
+	}
+
+	select {
+	case err := <-call.done:
+		if err != nil {
+			return err
+		}
+		if verr := c.validator.Validate(response); verr != nil {
+			return &OCPPError{Code: ErrorCodeProtocolError, Description: verr.Error()}
+		}
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, uniqueID)
+		c.mu.Unlock()
+		return fmt.Errorf("ocpp: call %q timed out: %w", action, ctx.Err())
+	}
+}
+
+func newUniqueID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+// BootNotification sends a BootNotification CALL over OCPP-J.
+func (c *WebSocketClient) BootNotification(ctx context.Context, chargeBoxIdentity string) (*BootNotificationResponse, error) {
+	request := BootNotificationRequest{ChargeBoxIdentity: chargeBoxIdentity}
+	response := &BootNotificationResponse{}
+	if err := c.Call(ctx, "BootNotification", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Heartbeat sends a Heartbeat CALL over OCPP-J.
+func (c *WebSocketClient) Heartbeat(ctx context.Context) (*HeartbeatResponse, error) {
+	response := &HeartbeatResponse{}
+	if err := c.Call(ctx, "Heartbeat", HeartbeatRequest{}, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Authorize sends an Authorize CALL over OCPP-J, consulting the configured
+// AuthorizationStore (see SetAuthStore) when the remote call fails, and
+// caching every successful response so the station stays authorized
+// offline. Group idTags (ParentIdTag set) are resolved against the cached
+// parent entry.
+func (c *WebSocketClient) Authorize(ctx context.Context, idTag string) (*AuthorizeResponse, error) {
+	return authorizeWithCache(c.authorizationStore(), idTag, func() (*AuthorizeResponse, error) {
+		request := AuthorizeRequest{IdTag: idTag}
+		response := &AuthorizeResponse{}
+		if err := c.Call(ctx, "Authorize", request, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	})
+}
+
+// StartTransaction sends a StartTransaction CALL over OCPP-J.
+func (c *WebSocketClient) StartTransaction(ctx context.Context, connectorId int, idTag string) (*StartTransactionResponse, error) {
+	request := StartTransactionRequest{ConnectorId: connectorId, IdTag: idTag}
+	response := &StartTransactionResponse{}
+	if err := c.Call(ctx, "StartTransaction", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// StopTransaction sends a StopTransaction CALL over OCPP-J.
+func (c *WebSocketClient) StopTransaction(ctx context.Context, transactionId int) (*StopTransactionResponse, error) {
+	request := StopTransactionRequest{TransactionId: transactionId}
+	response := &StopTransactionResponse{}
+	if err := c.Call(ctx, "StopTransaction", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// MeterValues sends a MeterValues CALL over OCPP-J.
+func (c *WebSocketClient) MeterValues(ctx context.Context, values []MeterValue) error {
+	request := MeterValuesRequest{Values: values}
+	response := &MeterValuesResponse{}
+	return c.Call(ctx, "MeterValues", request, response)
+}
+
+// StatusNotification sends a StatusNotification CALL over OCPP-J.
+func (c *WebSocketClient) StatusNotification(ctx context.Context, status Status) error {
+	request := StatusNotificationRequest{Status: status}
+	response := &StatusNotificationResponse{}
+	return c.Call(ctx, "StatusNotification", request, response)
+}
+
+// DataTransfer sends a DataTransfer CALL over OCPP-J.
+func (c *WebSocketClient) DataTransfer(ctx context.Context, vendorId, messageData string) (*DataTransferResponse, error) {
+	request := DataTransferRequest{VendorId: vendorId, MessageData: messageData}
+	response := &DataTransferResponse{}
+	if err := c.Call(ctx, "DataTransfer", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
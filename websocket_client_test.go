@@ -0,0 +1,89 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newTestWebSocketClient() *WebSocketClient {
+	c := NewWebSocketClient("wss://example.com/ocpp", "CP1", nil)
+	c.SetValidator(WithoutValidation())
+	return c
+}
+
+func TestDispatchResolvesPendingCallResult(t *testing.T) {
+	c := newTestWebSocketClient()
+	response := &HeartbeatResponse{}
+	call := &pendingCall{response: response, done: make(chan error, 1)}
+	c.pending["abc123"] = call
+
+	raw, _ := json.Marshal([]interface{}{messageTypeCallResult, "abc123", HeartbeatResponse{CurrentTime: "2026-01-01T00:00:00Z"}})
+	c.dispatch(raw)
+
+	select {
+	case err := <-call.done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	default:
+		t.Fatal("expected dispatch to resolve the pending call")
+	}
+	if response.CurrentTime != "2026-01-01T00:00:00Z" {
+		t.Fatalf("response not decoded into the pending call's response, got %+v", response)
+	}
+	if _, ok := c.pending["abc123"]; ok {
+		t.Fatal("expected dispatch to remove the resolved call from pending")
+	}
+}
+
+func TestDispatchResolvesPendingCallError(t *testing.T) {
+	c := newTestWebSocketClient()
+	call := &pendingCall{response: &HeartbeatResponse{}, done: make(chan error, 1)}
+	c.pending["abc123"] = call
+
+	raw, _ := json.Marshal([]interface{}{messageTypeCallError, "abc123", ErrorCodeNotImplemented, "nope", json.RawMessage("{}")})
+	c.dispatch(raw)
+
+	select {
+	case err := <-call.done:
+		ocppErr, ok := err.(*OCPPError)
+		if !ok {
+			t.Fatalf("expected *OCPPError, got %T (%v)", err, err)
+		}
+		if ocppErr.Code != ErrorCodeNotImplemented || ocppErr.Description != "nope" {
+			t.Fatalf("unexpected OCPPError: %+v", ocppErr)
+		}
+	default:
+		t.Fatal("expected dispatch to resolve the pending call")
+	}
+}
+
+func TestDispatchRoutesInboundCallToHandler(t *testing.T) {
+	c := newTestWebSocketClient()
+
+	var gotPayload string
+	c.SetCallHandler("Reset", func(payload json.RawMessage) (interface{}, error) {
+		var req ResetRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		gotPayload = string(req.Type)
+		return &ResetResponse{Status: ResetStatusAccepted}, nil
+	})
+
+	raw, _ := json.Marshal([]interface{}{messageTypeCall, "xyz", "Reset", ResetRequest{Type: ResetTypeHard}})
+	c.dispatch(raw)
+
+	if gotPayload != string(ResetTypeHard) {
+		t.Fatalf("expected the registered Reset handler to run, got payload %q", gotPayload)
+	}
+}
+
+func TestDispatchUnregisteredCallDoesNotPanic(t *testing.T) {
+	c := newTestWebSocketClient()
+	raw, _ := json.Marshal([]interface{}{messageTypeCall, "xyz", "SomeUnknownAction", map[string]interface{}{}})
+	c.dispatch(raw) // must not panic, and must not touch c.pending (no handler registered)
+	if len(c.pending) != 0 {
+		t.Fatalf("expected dispatch of an unregistered CALL to leave pending empty, got %d entries", len(c.pending))
+	}
+}